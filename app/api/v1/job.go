@@ -2,10 +2,14 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"os"
 
 	"github.com/gogdl-ng/gogdl-ng/app/download"
 	"github.com/gogdl-ng/gogdl-ng/app/logging"
+	"github.com/gorilla/mux"
 )
 
 type JobController struct {
@@ -21,6 +25,8 @@ func (controller *JobController) CreateJob() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		CreateJobRequest := struct {
 			DriveId string
+			DryRun  bool
+			download.JobOptions
 		}{}
 
 		if err := json.NewDecoder(r.Body).Decode(&CreateJobRequest); err != nil {
@@ -34,13 +40,128 @@ func (controller *JobController) CreateJob() http.HandlerFunc {
 
 			controller.logger.Error(msg)
 			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		if err := controller.jobManager.ValidateOptions(&CreateJobRequest.JobOptions); err != nil {
+			controller.logger.Errorf("invalid job options. %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		if err := controller.jobManager.CreateJob(CreateJobRequest.DriveId); err != nil {
+		if CreateJobRequest.DryRun {
+			preview, err := controller.jobManager.Preview(CreateJobRequest.DriveId, &CreateJobRequest.JobOptions)
+
+			if err != nil {
+				controller.logger.Errorf("failed to preview job. %v", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			writeJson(w, preview)
+			return
+		}
+
+		err := controller.jobManager.CreateJob(CreateJobRequest.DriveId, &CreateJobRequest.JobOptions)
+
+		if errors.Is(err, download.ErrJobExists) {
+			controller.logger.Error(err)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		if err != nil {
 			controller.logger.Errorf("failed to register a new job. %v", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 
 		controller.logger.Infof("registered new job (driveId: %s)", CreateJobRequest.DriveId)
 	}
 }
+
+func (controller *JobController) GetJob() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		driveId := mux.Vars(r)["id"]
+
+		record, err := controller.jobManager.ReadJobRecord(driveId)
+
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			controller.logger.Errorf("failed to read job record. %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(w, record)
+	}
+}
+
+func (controller *JobController) VerifyJob() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		driveId := mux.Vars(r)["id"]
+
+		VerifyJobRequest := struct {
+			Requeue bool
+		}{}
+
+		if err := json.NewDecoder(r.Body).Decode(&VerifyJobRequest); err != nil && err != io.EOF {
+			controller.logger.Errorf("failed to decode request json to object. %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		report, err := controller.jobManager.VerifyJob(driveId, VerifyJobRequest.Requeue)
+
+		if errors.Is(err, os.ErrNotExist) {
+			controller.logger.Error(err)
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, download.ErrJobExists) {
+			controller.logger.Error(err)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			controller.logger.Errorf("failed to verify job. %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(w, report)
+	}
+}
+
+func (controller *JobController) CancelJob() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		driveId := mux.Vars(r)["id"]
+
+		err := controller.jobManager.CancelJob(driveId)
+
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			controller.logger.Errorf("failed to cancel job. %v", err)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		controller.logger.Infof("cancelled job (driveId: %s)", driveId)
+	}
+}
+
+func writeJson(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gogdl-ng/gogdl-ng/app/download"
+	"github.com/gogdl-ng/gogdl-ng/app/gdrive"
+)
+
+func (controller *JobController) Preview() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		PreviewRequest := struct {
+			DriveId string
+			Url     string
+			download.JobOptions
+		}{}
+
+		if err := json.NewDecoder(r.Body).Decode(&PreviewRequest); err != nil {
+			controller.logger.Errorf("failed to decode request json to object. %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		value := PreviewRequest.DriveId
+
+		if len(value) == 0 {
+			value = PreviewRequest.Url
+		}
+
+		driveId, err := gdrive.ParseDriveId(value)
+
+		if err != nil {
+			controller.logger.Error(err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := controller.jobManager.ValidateOptions(&PreviewRequest.JobOptions); err != nil {
+			controller.logger.Errorf("invalid job options. %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		preview, err := controller.jobManager.Preview(driveId, &PreviewRequest.JobOptions)
+
+		if err != nil {
+			controller.logger.Errorf("failed to preview folder. %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(w, preview)
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gogdl-ng/gogdl-ng/app/download"
+	"github.com/gogdl-ng/gogdl-ng/app/gdrive"
+	"github.com/gogdl-ng/gogdl-ng/app/logging"
+	"github.com/gogdl-ng/gogdl-ng/app/watch"
+	"github.com/gorilla/mux"
+)
+
+type WatchController struct {
+	logger    logging.Logger
+	scheduler *watch.Scheduler
+}
+
+func NewWatchController(logger logging.Logger, scheduler *watch.Scheduler) *WatchController {
+	return &WatchController{logger: logger, scheduler: scheduler}
+}
+
+func (controller *WatchController) GetWatches() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, controller.scheduler.GetWatches())
+	}
+}
+
+func (controller *WatchController) CreateWatch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		CreateWatchRequest := struct {
+			DriveId        string
+			Url            string
+			Interval       string
+			IgnoreExisting bool
+			download.JobOptions
+		}{}
+
+		if err := json.NewDecoder(r.Body).Decode(&CreateWatchRequest); err != nil {
+			controller.logger.Errorf("failed to decode request json to object. %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		value := CreateWatchRequest.DriveId
+
+		if len(value) == 0 {
+			value = CreateWatchRequest.Url
+		}
+
+		driveId, err := gdrive.ParseDriveId(value)
+
+		if err != nil {
+			controller.logger.Error(err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		newWatch := &watch.Watch{
+			DriveId:  driveId,
+			Interval: CreateWatchRequest.Interval,
+			Options:  &CreateWatchRequest.JobOptions,
+		}
+
+		if err := controller.scheduler.AddWatch(newWatch, CreateWatchRequest.IgnoreExisting); err != nil {
+			controller.logger.Errorf("failed to register a new watch. %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		controller.logger.Infof("registered new watch (driveId: %s)", driveId)
+
+		writeJson(w, newWatch)
+	}
+}
+
+func (controller *WatchController) DeleteWatch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		driveId := mux.Vars(r)["id"]
+
+		removed, err := controller.scheduler.RemoveWatch(driveId)
+
+		if err != nil {
+			controller.logger.Errorf("failed to remove watch. %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if !removed {
+			http.Error(w, "watch not found", http.StatusNotFound)
+			return
+		}
+
+		controller.logger.Infof("removed watch (driveId: %s)", driveId)
+	}
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gogdl-ng/gogdl-ng/app/logging"
+	"github.com/gogdl-ng/gogdl-ng/app/webhook"
+	"github.com/gorilla/mux"
+)
+
+type WebhookController struct {
+	logger   logging.Logger
+	notifier *webhook.Notifier
+}
+
+func NewWebhookController(logger logging.Logger, notifier *webhook.Notifier) *WebhookController {
+	return &WebhookController{logger: logger, notifier: notifier}
+}
+
+func (controller *WebhookController) GetWebhooks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, controller.notifier.GetWebhooks())
+	}
+}
+
+func (controller *WebhookController) CreateWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		CreateWebhookRequest := struct {
+			Url      string
+			Secret   string
+			Template string
+			Events   []string
+		}{}
+
+		if err := json.NewDecoder(r.Body).Decode(&CreateWebhookRequest); err != nil {
+			controller.logger.Errorf("failed to decode request json to object. %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		newWebhook := &webhook.Webhook{
+			Url:      CreateWebhookRequest.Url,
+			Secret:   CreateWebhookRequest.Secret,
+			Template: CreateWebhookRequest.Template,
+			Events:   CreateWebhookRequest.Events,
+		}
+
+		if err := newWebhook.Validate(); err != nil {
+			controller.logger.Errorf("invalid webhook. %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := controller.notifier.AddWebhook(newWebhook); err != nil {
+			controller.logger.Errorf("failed to register webhook. %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		controller.logger.Infof("registered new webhook (url: %s)", newWebhook.Url)
+
+		writeJson(w, struct{ Id string }{newWebhook.Id})
+	}
+}
+
+func (controller *WebhookController) DeleteWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+
+		removed, err := controller.notifier.RemoveWebhook(id)
+
+		if err != nil {
+			controller.logger.Errorf("failed to remove webhook. %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if !removed {
+			http.Error(w, "webhook not found", http.StatusNotFound)
+			return
+		}
+
+		controller.logger.Infof("removed webhook (id: %s)", id)
+	}
+}
+
+func (controller *WebhookController) TestWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+
+		found, err := controller.notifier.TestWebhook(id)
+
+		if !found {
+			http.Error(w, "webhook not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			controller.logger.Errorf("failed to send test event to webhook. %v", err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+}
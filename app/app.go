@@ -1,20 +1,32 @@
 package app
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
 
 	"github.com/gogdl-ng/gogdl-ng/app/api/v1"
+	"github.com/gogdl-ng/gogdl-ng/app/blackhole"
 	"github.com/gogdl-ng/gogdl-ng/app/config"
 	"github.com/gogdl-ng/gogdl-ng/app/download"
 	"github.com/gogdl-ng/gogdl-ng/app/gdrive"
 	"github.com/gogdl-ng/gogdl-ng/app/logging"
+	"github.com/gogdl-ng/gogdl-ng/app/watch"
+	"github.com/gogdl-ng/gogdl-ng/app/webhook"
 	"github.com/gorilla/mux"
 )
 
 func Run() {
-	conf, err := config.NewConfigurationFromFile()
+	configPath := flag.String("config", "", "path to the configuration file (default \"./config/config.toml\")")
+	flag.Parse()
+
+	conf, err := config.NewConfigurationFromFile(*configPath)
 
 	if err != nil {
 		log.Fatalf("Failed to retrieve app configuration. %v", err)
@@ -38,18 +50,119 @@ func Run() {
 		logger.Fatalf("Failed to create job manager. %v", err)
 	}
 
+	notifier, err := webhook.NewNotifier(logger, conf)
+
+	if err != nil {
+		logger.Fatalf("Failed to create webhook notifier. %v", err)
+	}
+
+	drive.SetNotifier(notifier)
+	jobManager.SetNotifier(notifier)
+
+	if flag.Arg(0) == "verify" {
+		verify(conf, jobManager, flag.Args()[1:])
+		return
+	}
+
+	watchStore, err := watch.NewStore(conf.Paths.State)
+
+	if err != nil {
+		logger.Fatalf("Failed to read watches. %v", err)
+	}
+
+	scheduler := watch.NewScheduler(logger, drive, jobManager, watchStore)
+
 	router := mux.NewRouter().StrictSlash(true)
 	router = router.PathPrefix("/api/v1").Subrouter()
 
 	controller := api.NewJobController(logger, jobManager)
 
 	router.HandleFunc("/jobs", controller.CreateJob()).Methods("POST")
+	router.HandleFunc("/jobs/{id}", controller.GetJob()).Methods("GET")
+	router.HandleFunc("/jobs/{id}", controller.CancelJob()).Methods("DELETE")
+	router.HandleFunc("/jobs/{id}/verify", controller.VerifyJob()).Methods("POST")
+	router.HandleFunc("/preview", controller.Preview()).Methods("POST")
+
+	watchController := api.NewWatchController(logger, scheduler)
+
+	router.HandleFunc("/watches", watchController.GetWatches()).Methods("GET")
+	router.HandleFunc("/watches", watchController.CreateWatch()).Methods("POST")
+	router.HandleFunc("/watches/{id}", watchController.DeleteWatch()).Methods("DELETE")
+
+	webhookController := api.NewWebhookController(logger, notifier)
+
+	router.HandleFunc("/webhooks", webhookController.GetWebhooks()).Methods("GET")
+	router.HandleFunc("/webhooks", webhookController.CreateWebhook()).Methods("POST")
+	router.HandleFunc("/webhooks/{id}", webhookController.DeleteWebhook()).Methods("DELETE")
+	router.HandleFunc("/webhooks/{id}/test", webhookController.TestWebhook()).Methods("POST")
 
 	go listenAndServe(router, conf.Application.ListenPort)
+	go scheduler.Run()
+	go notifier.Run()
+
+	if len(conf.Blackhole.Path) > 0 {
+		watcher, err := blackhole.NewWatcher(logger, jobManager, conf.Blackhole.Path, conf.Blackhole.Interval)
+
+		if err != nil {
+			logger.Fatalf("Failed to create blackhole watcher. %v", err)
+		}
+
+		go watcher.Run()
+	}
 
 	jobManager.Run()
 }
 
+// verify implements the verify command which prints the verification report of
+// a finished job: gogdl-ng verify [-requeue] <drive id>
+// With -requeue the running server verifies the job, since only it can run the
+// requeued job.
+func verify(conf *config.Configuration, jobManager *download.JobManager, args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	requeue := flags.Bool("requeue", false, "download missing and mismatching files again")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		log.Fatal("usage: gogdl-ng verify [-requeue] <drive id>")
+	}
+
+	if *requeue {
+		requestVerification(conf.Application.ListenPort, flags.Arg(0))
+		return
+	}
+
+	report, err := jobManager.VerifyJob(flags.Arg(0), false)
+
+	if err != nil {
+		log.Fatalf("Failed to verify job. %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+}
+
+// requestVerification calls the verify endpoint of the server which listens on
+// the given port and prints its report.
+func requestVerification(listenPort int, driveId string) {
+	address := fmt.Sprintf("http://localhost:%d/api/v1/jobs/%s/verify", listenPort, url.PathEscape(driveId))
+
+	response, err := http.Post(address, "application/json", strings.NewReader(`{"Requeue":true}`))
+
+	if err != nil {
+		log.Fatalf("Failed to reach the running server. %v", err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(response.Body)
+		log.Fatalf("Failed to verify job. %s", strings.TrimSpace(string(body)))
+	}
+
+	io.Copy(os.Stdout, response.Body)
+}
+
 func listenAndServe(router *mux.Router, listenPort int) {
 	addr := fmt.Sprintf(":%d", listenPort)
 
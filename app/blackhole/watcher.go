@@ -0,0 +1,226 @@
+package blackhole
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gogdl-ng/gogdl-ng/app/download"
+	"github.com/gogdl-ng/gogdl-ng/app/gdrive"
+	"github.com/gogdl-ng/gogdl-ng/app/logging"
+)
+
+const (
+	processedFolderName = "processed"
+	failedFolderName    = "failed"
+	errorFileSuffix     = ".error.txt"
+
+	defaultInterval = 10 * time.Second
+
+	// settleTime is the time a file has to stay unchanged before it is
+	// processed, so files which are still being written are not picked up.
+	settleTime = 2 * time.Second
+)
+
+// jobSpec is the content of a json job file.
+type jobSpec struct {
+	DriveId string
+	Url     string
+	download.JobOptions
+}
+
+// Watcher polls the blackhole folder and creates jobs from the files which are
+// dropped into it.
+type Watcher struct {
+	logger     logging.Logger
+	jobManager *download.JobManager
+	path       string
+	interval   time.Duration
+}
+
+func NewWatcher(logger logging.Logger, jm *download.JobManager, path string, intervalSeconds int) (*Watcher, error) {
+	for _, folderName := range []string{processedFolderName, failedFolderName} {
+		if err := os.MkdirAll(filepath.Join(path, folderName), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	interval := time.Duration(intervalSeconds) * time.Second
+
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	return &Watcher{logger: logger, jobManager: jm, path: path, interval: interval}, nil
+}
+
+func (watcher *Watcher) Run() {
+	for {
+		if err := watcher.processFiles(); err != nil {
+			watcher.logger.Errorf("failed to read blackhole folder. %v", err)
+		}
+
+		time.Sleep(watcher.interval)
+	}
+}
+
+func (watcher *Watcher) processFiles() error {
+	items, err := os.ReadDir(watcher.path)
+
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		extension := strings.ToLower(filepath.Ext(item.Name()))
+
+		if item.IsDir() || (extension != ".txt" && extension != ".json") {
+			continue
+		}
+
+		info, err := item.Info()
+
+		if err != nil || time.Since(info.ModTime()) < settleTime {
+			continue
+		}
+
+		path := filepath.Join(watcher.path, item.Name())
+		errs := watcher.processFile(path, extension)
+
+		if err := watcher.moveFile(path, errs); err != nil {
+			watcher.logger.Errorf("failed to move blackhole file '%s'. %v", path, err)
+		}
+	}
+
+	return nil
+}
+
+// processFile creates the jobs of the file. It returns an error for every job
+// which could not be created.
+func (watcher *Watcher) processFile(path string, extension string) []error {
+	buf, err := os.ReadFile(path)
+
+	if err != nil {
+		return []error{err}
+	}
+
+	var specs []*jobSpec
+
+	if extension == ".json" {
+		specs, err = parseJsonFile(buf)
+	} else {
+		specs, err = parseTextFile(buf)
+	}
+
+	if err != nil {
+		return []error{err}
+	}
+
+	var errs []error
+
+	for _, spec := range specs {
+		if err := watcher.createJob(spec); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+func (watcher *Watcher) createJob(spec *jobSpec) error {
+	value := spec.DriveId
+
+	if len(value) == 0 {
+		value = spec.Url
+	}
+
+	driveId, err := gdrive.ParseDriveId(value)
+
+	if err != nil {
+		return err
+	}
+
+	if err := watcher.jobManager.CreateJob(driveId, &spec.JobOptions); err != nil {
+		return fmt.Errorf("failed to register a new job (driveId: %s). %v", driveId, err)
+	}
+
+	watcher.logger.Infof("registered new job from blackhole (driveId: %s)", driveId)
+
+	return nil
+}
+
+// parseTextFile reads one Google Drive id or url per line. Empty lines and
+// lines starting with '#' are ignored.
+func parseTextFile(buf []byte) ([]*jobSpec, error) {
+	var specs []*jobSpec
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		specs = append(specs, &jobSpec{DriveId: line})
+	}
+
+	return specs, scanner.Err()
+}
+
+// parseJsonFile reads a single job or an array of jobs.
+func parseJsonFile(buf []byte) ([]*jobSpec, error) {
+	var specs []*jobSpec
+
+	if bytes.HasPrefix(bytes.TrimSpace(buf), []byte("[")) {
+		err := json.Unmarshal(buf, &specs)
+
+		return specs, err
+	}
+
+	spec := &jobSpec{}
+
+	if err := json.Unmarshal(buf, spec); err != nil {
+		return nil, err
+	}
+
+	return append(specs, spec), nil
+}
+
+// moveFile moves the file to the processed folder. When errors occurred it is
+// moved to the failed folder instead and an error report is written next to it.
+func (watcher *Watcher) moveFile(path string, errs []error) error {
+	folderName := processedFolderName
+
+	if len(errs) > 0 {
+		folderName = failedFolderName
+	}
+
+	targetPath := filepath.Join(watcher.path, folderName, filepath.Base(path))
+
+	if _, err := os.Stat(targetPath); err == nil {
+		targetPath = filepath.Join(watcher.path, folderName, time.Now().Format("20060102-150405-")+filepath.Base(path))
+	}
+
+	if err := os.Rename(path, targetPath); err != nil {
+		return err
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	var report strings.Builder
+
+	for _, err := range errs {
+		watcher.logger.Errorf("failed to process blackhole file '%s'. %v", path, err)
+		report.WriteString(err.Error() + "\n")
+	}
+
+	return os.WriteFile(targetPath+errorFileSuffix, []byte(report.String()), 0644)
+}
@@ -19,11 +19,74 @@ type QueueConfiguration struct {
 }
 
 type DownloadConfiguration struct {
-	RetryThreeshold uint
+	RetryThreeshold        uint
+	ReservedDiskSpace      uint64
+	DiskSpaceCheckInterval int
+	MoveVerification       string
+	CollisionStrategy      string
+	SanitizeMode           string
+	MaxNameLength          int
+	PreserveFolderTimes    bool
+	ChecksumManifest       string
+	VerifyAlgorithm        string
+	QuotaExceededDelay     string
+	AllowAnyDestination    bool
+}
+
+type FilterConfiguration struct {
+	Include   []string
+	Exclude   []string
+	MinSize   int64
+	MaxSize   int64
+	MimeTypes []string
+	MaxDepth  int
 }
 
 type GDriveConfiguration struct {
-	Query string
+	Query            string
+	SkipShortcuts    bool
+	AcknowledgeAbuse bool
+	Filter           FilterConfiguration
+}
+
+type PathsConfiguration struct {
+	Config     string
+	State      string
+	Root       string
+	Incomplete string
+	Completed  string
+}
+
+type BlackholeConfiguration struct {
+	Path     string
+	Interval int
+}
+
+type ExtractConfiguration struct {
+	Enabled      bool
+	Command      string
+	PasswordFile string
+	KeepArchives bool
+	Timeout      int
+}
+
+type HookConfiguration struct {
+	Command string
+	Args    []string
+	Timeout int
+	FailJob bool
+}
+
+type WebhookConfiguration struct {
+	Url      string
+	Secret   string
+	Template string
+	Events   []string
+}
+
+type CategoryConfiguration struct {
+	Path  string
+	Hooks []HookConfiguration
 }
 
 type Configuration struct {
@@ -33,16 +96,38 @@ type Configuration struct {
 	Queue       QueueConfiguration
 	GDrive      GDriveConfiguration
 	Download    DownloadConfiguration
+	Paths       PathsConfiguration
+	Categories  map[string]CategoryConfiguration
+	Blackhole   BlackholeConfiguration
+	Extract     ExtractConfiguration
+	Hooks       []HookConfiguration
+	Webhooks    []WebhookConfiguration
 }
 
 const (
-	configFolderName string = "config"
-	configFileName   string = "config.toml"
+	configFolderName     string = "config"
+	configFileName       string = "config.toml"
+	downloadsFolderName  string = "downloads"
+	incompleteFolderName string = "incomplete"
+	completedFolderName  string = "completed"
 )
 
-func NewConfigurationFromFile() (*Configuration, error) {
+// NewConfigurationFromFile reads the configuration from the given file. When
+// no path is given the file is read from the config folder in the working
+// directory.
+func NewConfigurationFromFile(path string) (*Configuration, error) {
 	var conf Configuration
-	path, err := getConfigurationPath()
+	var err error
+
+	if len(path) == 0 {
+		path, err = getConfigurationPath()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	path, err = filepath.Abs(path)
 
 	if err != nil {
 		return nil, err
@@ -57,11 +142,67 @@ func NewConfigurationFromFile() (*Configuration, error) {
 	conf.path = path
 	conf.GDrive.Query = strings.TrimSpace(conf.GDrive.Query)
 
+	// relative paths are relative to the folder of the configuration file, so
+	// the application does not depend on the working directory.
+	configFolderPath := filepath.Dir(path)
+
+	conf.Paths.resolve(configFolderPath)
+
+	conf.Application.LogFilePath = resolvePath(configFolderPath, conf.Application.LogFilePath)
+	conf.Blackhole.Path = resolvePath(configFolderPath, conf.Blackhole.Path)
+	conf.Extract.PasswordFile = resolvePath(configFolderPath, conf.Extract.PasswordFile)
+
+	for name, category := range conf.Categories {
+		category.Path = resolvePath(configFolderPath, category.Path)
+		conf.Categories[name] = category
+	}
+
 	return &conf, nil
 }
 
+// resolvePath turns a relative path into an absolute one based on the given
+// folder. An empty path stays empty.
+func resolvePath(folderPath string, path string) string {
+	if len(path) == 0 || filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(folderPath, path)
+}
+
 func (config *Configuration) GetConfigurationFolderPath() string {
-	return filepath.Dir(config.path)
+	return config.Paths.Config
+}
+
+// resolve fills every path which is not configured with its default value and
+// turns all paths into absolute ones.
+func (paths *PathsConfiguration) resolve(configFolderPath string) {
+	paths.Config = resolvePath(configFolderPath, paths.Config)
+	paths.State = resolvePath(configFolderPath, paths.State)
+	paths.Root = resolvePath(configFolderPath, paths.Root)
+
+	if len(paths.Config) == 0 {
+		paths.Config = configFolderPath
+	}
+
+	if len(paths.State) == 0 {
+		paths.State = paths.Config
+	}
+
+	if len(paths.Root) == 0 {
+		paths.Root = filepath.Join(configFolderPath, downloadsFolderName)
+	}
+
+	paths.Incomplete = resolvePath(paths.Root, paths.Incomplete)
+	paths.Completed = resolvePath(paths.Root, paths.Completed)
+
+	if len(paths.Incomplete) == 0 {
+		paths.Incomplete = filepath.Join(paths.Root, incompleteFolderName)
+	}
+
+	if len(paths.Completed) == 0 {
+		paths.Completed = filepath.Join(paths.Root, completedFolderName)
+	}
 }
 
 func getConfigurationPath() (string, error) {
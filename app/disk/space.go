@@ -0,0 +1,36 @@
+//go:build !windows
+// +build !windows
+
+package disk
+
+import "syscall"
+
+// Megabyte is the number of bytes in a megabyte.
+const Megabyte = 1 << 20
+
+// FreeSpace returns the number of bytes which are available to the current
+// user on the volume of the given path.
+func FreeSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
+
+// SameVolume reports whether both paths are located on the same volume.
+func SameVolume(a string, b string) (bool, error) {
+	var statA, statB syscall.Stat_t
+
+	if err := syscall.Stat(a, &statA); err != nil {
+		return false, err
+	}
+
+	if err := syscall.Stat(b, &statB); err != nil {
+		return false, err
+	}
+
+	return statA.Dev == statB.Dev, nil
+}
@@ -0,0 +1,46 @@
+package disk
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// Megabyte is the number of bytes in a megabyte.
+const Megabyte = 1 << 20
+
+// FreeSpace returns the number of bytes which are available to the current
+// user on the volume of the given path.
+func FreeSpace(path string) (uint64, error) {
+	var freeBytesAvailable uint64
+
+	pathPtr, err := windows.UTF16PtrFromString(path)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err := windows.GetDiskFreeSpaceEx(pathPtr, &freeBytesAvailable, nil, nil); err != nil {
+		return 0, err
+	}
+
+	return freeBytesAvailable, nil
+}
+
+// SameVolume reports whether both paths are located on the same volume.
+func SameVolume(a string, b string) (bool, error) {
+	a, err := filepath.Abs(a)
+
+	if err != nil {
+		return false, err
+	}
+
+	b, err = filepath.Abs(b)
+
+	if err != nil {
+		return false, err
+	}
+
+	return strings.EqualFold(filepath.VolumeName(a), filepath.VolumeName(b)), nil
+}
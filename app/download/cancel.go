@@ -0,0 +1,96 @@
+package download
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// CancelJob cancels the unfinished job of the folder. The job directory of a
+// running job is removed once the file which is currently downloaded is
+// finished, the one of any other job right away. A job which is already being
+// moved to its target directory can not be cancelled.
+func (jm *JobManager) CancelJob(driveId string) error {
+	path, err := jm.getJobDirectoryPath(driveId)
+
+	if err != nil {
+		return err
+	}
+
+	state, err := jm.readJobFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	if state.Status == JobStatusMoving {
+		return fmt.Errorf("job of folder '%s' is already being moved", driveId)
+	}
+
+	jm.mutex.Lock()
+	job := jm.removeDeferredJob(driveId)
+	active := jm.active[driveId]
+
+	if active {
+		jm.cancelled[driveId] = true
+	}
+
+	jm.mutex.Unlock()
+
+	// the worker of an active job removes it once the current file is done.
+	if active {
+		return nil
+	}
+
+	// a deferred job, or one whose run was aborted, is not owned by a worker.
+	if job == nil {
+		job = &Job{Path: path, File: &drive.File{Id: driveId, Name: filepath.Base(path)}}
+	}
+
+	jm.removeCancelledJob(job)
+
+	return nil
+}
+
+func (jm *JobManager) isCancelled(driveId string) bool {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	return jm.cancelled[driveId]
+}
+
+// removeCancelledJob deletes the directory of a cancelled job.
+func (jm *JobManager) removeCancelledJob(job *Job) {
+	jm.mutex.Lock()
+	delete(jm.cancelled, job.Id)
+	jm.mutex.Unlock()
+
+	jm.logger.Infof("job for folder '%s' was cancelled", job.Id)
+
+	if err := os.RemoveAll(job.Path); err != nil {
+		jm.logger.Errorf("failed to remove directory of cancelled job '%s'. %v", job.Id, err)
+	}
+
+	jm.notify(EventJobCancelled, job, job.Path, "Job '%s' was cancelled.", job.Name)
+}
+
+// getJobDirectoryPath returns the incomplete directory of the folder.
+func (jm *JobManager) getJobDirectoryPath(driveId string) (string, error) {
+	subfolders, err := jm.getSubfolders(jm.IncompleteDirectoryPath)
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, path := range subfolders {
+		id, err := jm.readDriveIdFile(path)
+
+		if err == nil && id == driveId {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("no unfinished job found for folder '%s'. %w", driveId, os.ErrNotExist)
+}
@@ -0,0 +1,60 @@
+package download
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// errCommandTimedOut is returned when a command was killed because it ran
+// longer than its timeout.
+var errCommandTimedOut = errors.New("command timed out")
+
+// runCommand runs the command and returns its combined output. The output is
+// written to a temporary file instead of a pipe, so a background process
+// which inherited it does not keep the command from finishing. On timeout the
+// whole process group of the command is killed.
+func runCommand(cmd *exec.Cmd, timeout time.Duration) (string, error) {
+	output, err := os.CreateTemp("", "gogdl-ng-output-*")
+
+	if err != nil {
+		return "", err
+	}
+
+	defer os.Remove(output.Name())
+	defer output.Close()
+
+	cmd.Stdout = output
+	cmd.Stderr = output
+	setProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err = <-done:
+	case <-timer.C:
+		killProcessGroup(cmd)
+		<-done
+		err = errCommandTimedOut
+	}
+
+	buf, readErr := os.ReadFile(output.Name())
+
+	if readErr != nil && err == nil {
+		err = readErr
+	}
+
+	return string(buf), err
+}
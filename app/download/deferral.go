@@ -0,0 +1,133 @@
+package download
+
+import (
+	"time"
+
+	"github.com/gogdl-ng/gogdl-ng/app/gdrive"
+)
+
+const (
+	reasonDownloadQuotaExceeded = "downloadQuotaExceeded"
+
+	defaultQuotaExceededDelay = 24 * time.Hour
+	deferralCheckInterval     = time.Minute
+
+	// failedJobRetryDelay is the delay until an aborted job is run again.
+	failedJobRetryDelay = 15 * time.Minute
+)
+
+func isDownloadQuotaExceeded(err error) bool {
+	return gdrive.ClassifyError(err).Reason == reasonDownloadQuotaExceeded
+}
+
+// deferJob parks the job for the given delay, e.g. until the download quota of
+// its files was reset or enough disk space is free. The files which were
+// completed in the meantime are not downloaded again. An interrupted move keeps
+// its status to be resumed as such.
+func (jm *JobManager) deferJob(job *Job, delay time.Duration, reason string) {
+	if job.Status != JobStatusMoving {
+		job.Status = JobStatusDeferred
+	}
+
+	job.DeferredUntil = time.Now().Add(delay)
+	job.addHistory("%s. deferring job until %s", reason, job.DeferredUntil.Format(time.RFC3339))
+
+	jm.logger.Warnf("deferring job for folder '%s' until %s. %s", job.Id, job.DeferredUntil.Format(time.RFC3339), reason)
+
+	if err := jm.writeJobFile(job); err != nil {
+		jm.logger.Errorf("failed to write job file of folder: '%s'. %v", job.Id, err)
+	}
+
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	jm.deferred = append(jm.deferred, job)
+}
+
+// getDiskSpaceRecheckDelay returns after how long a job which did not fit on
+// the volume checks the free disk space again.
+func (jm *JobManager) getDiskSpaceRecheckDelay() time.Duration {
+	delay := time.Duration(jm.conf.Download.DiskSpaceCheckInterval) * time.Second
+
+	if delay <= 0 {
+		return time.Minute
+	}
+
+	return delay
+}
+
+func (jm *JobManager) getQuotaExceededDelay() time.Duration {
+	delay, err := time.ParseDuration(jm.conf.Download.QuotaExceededDelay)
+
+	if err != nil || delay <= 0 {
+		return defaultQuotaExceededDelay
+	}
+
+	return delay
+}
+
+// runDeferredJobs queues the deferred jobs once their time has come.
+func (jm *JobManager) runDeferredJobs() {
+	ticker := time.NewTicker(deferralCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, job := range jm.getDueDeferredJobs() {
+			jm.logger.Infof("resuming deferred job for folder '%s'", job.Id)
+
+			if job.Status == JobStatusDeferred {
+				job.Status = JobStatusQueued
+			}
+
+			job.DeferredUntil = time.Time{}
+			job.addHistory("resuming deferred job")
+
+			if err := jm.writeJobFile(job); err != nil {
+				jm.logger.Errorf("failed to write job file of folder: '%s'. %v", job.Id, err)
+			}
+
+			// the job was already marked as active by getDueDeferredJobs.
+			jm.dispatcher.AddJob(job)
+		}
+
+		<-ticker.C
+	}
+}
+
+func (jm *JobManager) getDueDeferredJobs() []*Job {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	var due []*Job
+	var deferred []*Job
+
+	for _, job := range jm.deferred {
+		if time.Now().Before(job.DeferredUntil) {
+			deferred = append(deferred, job)
+			continue
+		}
+
+		// a due job is active right away, so it can not be removed by
+		// CancelJob before it was queued.
+		jm.active[job.Id] = true
+		due = append(due, job)
+	}
+
+	jm.deferred = deferred
+
+	return due
+}
+
+// removeDeferredJob removes the job of the folder from the deferred jobs and
+// returns it. It returns nil when the job is not deferred. The caller has to
+// hold the mutex.
+func (jm *JobManager) removeDeferredJob(driveId string) *Job {
+	for i, job := range jm.deferred {
+		if job.Id == driveId {
+			jm.deferred = append(jm.deferred[:i], jm.deferred[i+1:]...)
+			return job
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,344 @@
+package download
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultExtractTimeout = time.Hour
+
+var (
+	partRarPattern   = regexp.MustCompile(`(?i)^(.+)\.part(\d+)\.rar$`)
+	splitPattern     = regexp.MustCompile(`(?i)^(.+)\.(\d{3})$`)
+	rarVolumePattern = regexp.MustCompile(`(?i)^(.+)\.r(\d{2})$`)
+	zipVolumePattern = regexp.MustCompile(`(?i)^(.+)\.z(\d{2})$`)
+	archivePattern   = regexp.MustCompile(`(?i)^(.+)\.(zip|7z|rar)$`)
+)
+
+// archiveSet is an archive with all of its volumes. Paths are relative to the
+// job directory.
+type archiveSet struct {
+	Path    string
+	Volumes []string
+}
+
+func (jm *JobManager) shouldExtract(job *Job) bool {
+	return jm.conf.Extract.Enabled || job.Options.Extract
+}
+
+// extractArchives extracts the archives of the job directory into the folders
+// which contain them. Archives which could not be extracted fail the job.
+func (jm *JobManager) extractArchives(job *Job) error {
+	sets, err := findArchiveSets(job.Path)
+
+	if err != nil {
+		return err
+	}
+
+	if len(sets) == 0 {
+		return nil
+	}
+
+	passwords, err := jm.getArchivePasswords(job)
+
+	if err != nil {
+		return err
+	}
+
+	job.FailedArchives = nil
+
+	for _, set := range sets {
+		jm.logger.Infof("extracting archive '%s' of folder '%s'", set.Path, job.Id)
+
+		extractedFiles, err := jm.extractArchive(job.Path, set, passwords)
+
+		if err != nil {
+			jm.logger.Errorf("failed to extract archive '%s' of folder '%s'. %v", set.Path, job.Id, err)
+			job.FailedArchives = append(job.FailedArchives, set.Path)
+			job.addHistory("failed to extract archive '%s'. %v", set.Path, err)
+			continue
+		}
+
+		job.addHistory("extracted %d file(s) from archive '%s'", len(extractedFiles), set.Path)
+
+		if err := jm.completeArchive(job, set, extractedFiles); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extractArchive tries the passwords until the archive could be extracted. It
+// returns the extracted files. Leftovers of failed attempts are removed.
+func (jm *JobManager) extractArchive(root string, set *archiveSet, passwords []string) ([]string, error) {
+	existingFiles, err := listFiles(root)
+
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := passwords
+
+	if len(attempts) == 0 {
+		attempts = []string{""}
+	}
+
+	for _, password := range attempts {
+		err = jm.runExtractCommand(root, set, password)
+
+		if err == nil {
+			break
+		}
+	}
+
+	files, listErr := listFiles(root)
+
+	if listErr != nil {
+		return nil, listErr
+	}
+
+	var extractedFiles []string
+
+	for path := range files {
+		if !existingFiles[path] {
+			extractedFiles = append(extractedFiles, path)
+		}
+	}
+
+	sort.Strings(extractedFiles)
+
+	if err != nil {
+		for _, path := range extractedFiles {
+			os.Remove(filepath.Join(root, filepath.FromSlash(path)))
+		}
+
+		return nil, err
+	}
+
+	return extractedFiles, nil
+}
+
+func (jm *JobManager) runExtractCommand(root string, set *archiveSet, password string) error {
+	timeout := time.Duration(jm.conf.Extract.Timeout) * time.Second
+
+	if timeout <= 0 {
+		timeout = defaultExtractTimeout
+	}
+
+	path := filepath.Join(root, filepath.FromSlash(set.Path))
+	args := []string{"x", "-y", "-bd", "-o" + filepath.Dir(path)}
+
+	// 7-Zip asks for the password of an encrypted archive on stdin. It is not
+	// passed with -p, since the arguments are visible to every user.
+	cmd := exec.Command(jm.getExtractCommand(), append(args, path)...)
+	cmd.Stdin = strings.NewReader(password + "\n")
+	output, err := runCommand(cmd, timeout)
+
+	if errors.Is(err, errCommandTimedOut) {
+		return fmt.Errorf("extraction timed out after %s", timeout)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%v. %s", err, getLastLine(output))
+	}
+
+	return nil
+}
+
+func (jm *JobManager) getExtractCommand() string {
+	if len(jm.conf.Extract.Command) == 0 {
+		return "7z"
+	}
+
+	return jm.conf.Extract.Command
+}
+
+// completeArchive records the extracted files in the manifest and deletes the
+// volumes of the archive unless they are kept.
+func (jm *JobManager) completeArchive(job *Job, set *archiveSet, extractedFiles []string) error {
+	entries := make(map[string]*ManifestEntry)
+
+	for _, entry := range job.Manifest {
+		entries[entry.Path] = entry
+	}
+
+	if entry, ok := entries[set.Path]; ok {
+		entry.ExtractedFiles = extractedFiles
+	}
+
+	if jm.conf.Extract.KeepArchives {
+		return nil
+	}
+
+	for _, volume := range set.Volumes {
+		if err := os.Remove(filepath.Join(job.Path, filepath.FromSlash(volume))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		if entry, ok := entries[volume]; ok {
+			entry.Removed = true
+		}
+	}
+
+	return nil
+}
+
+// getArchivePasswords returns the passwords of the job followed by the ones of
+// the password file.
+func (jm *JobManager) getArchivePasswords(job *Job) ([]string, error) {
+	passwords := append([]string{}, job.Options.Passwords...)
+
+	if len(jm.conf.Extract.PasswordFile) == 0 {
+		return passwords, nil
+	}
+
+	file, err := os.Open(jm.conf.Extract.PasswordFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		if password := strings.TrimRight(scanner.Text(), "\r"); len(password) > 0 {
+			passwords = append(passwords, password)
+		}
+	}
+
+	return passwords, scanner.Err()
+}
+
+// findArchiveSets groups the archives of the directory into sets of volumes.
+// Sets whose first volume is missing are skipped.
+func findArchiveSets(root string) ([]*archiveSet, error) {
+	sets := make(map[string]*archiveSet)
+	var keys []string
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		key, first, ok := classifyArchive(entry.Name())
+
+		if !ok {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(root, path)
+
+		if err != nil {
+			return err
+		}
+
+		relativePath = filepath.ToSlash(relativePath)
+		key = filepath.Join(filepath.Dir(path), key)
+
+		set, ok := sets[key]
+
+		if !ok {
+			set = &archiveSet{}
+			sets[key] = set
+			keys = append(keys, key)
+		}
+
+		set.Volumes = append(set.Volumes, relativePath)
+
+		if first {
+			set.Path = relativePath
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(keys)
+
+	var result []*archiveSet
+
+	for _, key := range keys {
+		if set := sets[key]; len(set.Path) > 0 {
+			result = append(result, set)
+		}
+	}
+
+	return result, nil
+}
+
+// classifyArchive returns the key of the set the file belongs to and whether it
+// is the first volume of the set.
+func classifyArchive(name string) (string, bool, bool) {
+	if match := partRarPattern.FindStringSubmatch(name); match != nil {
+		n, _ := strconv.Atoi(match[2])
+		return strings.ToLower(match[1]) + "|partrar", n == 1, true
+	}
+
+	if match := splitPattern.FindStringSubmatch(name); match != nil {
+		return strings.ToLower(match[1]) + "|split", match[2] == "001", true
+	}
+
+	if match := rarVolumePattern.FindStringSubmatch(name); match != nil {
+		return strings.ToLower(match[1]) + "|rar", false, true
+	}
+
+	if match := zipVolumePattern.FindStringSubmatch(name); match != nil {
+		return strings.ToLower(match[1]) + "|zip", false, true
+	}
+
+	if match := archivePattern.FindStringSubmatch(name); match != nil {
+		return strings.ToLower(match[1]) + "|" + strings.ToLower(match[2]), true, true
+	}
+
+	return "", false, false
+}
+
+// listFiles returns the slash separated paths of all files in the directory
+// relative to it.
+func listFiles(root string) (map[string]bool, error) {
+	files := make(map[string]bool)
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(root, path)
+
+		if err != nil {
+			return err
+		}
+
+		files[filepath.ToSlash(relativePath)] = true
+
+		return nil
+	})
+
+	return files, err
+}
+
+func getLastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -1,15 +1,42 @@
 package download
 
 import (
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/gogdl-ng/gogdl-ng/app/gdrive"
 	"google.golang.org/api/drive/v3"
 )
 
 func (jm *JobManager) createJobDirectory(driveFolder *drive.File) (string, error) {
-	path := filepath.Join(jm.IncompleteDirectoryPath, driveFolder.Name)
+	name := jm.drive.GetSanitizedName(driveFolder.Name)
+	path := filepath.Join(jm.IncompleteDirectoryPath, name)
+
+	for n := 1; ; n++ {
+		inUse, err := isJobDirectoryInUse(path, driveFolder.Id)
+
+		if err != nil {
+			return "", err
+		}
+
+		if !inUse {
+			break
+		}
+
+		resolvedName, err := gdrive.ResolveNameCollision(name, driveFolder.Id, n, false, jm.conf.Download.CollisionStrategy)
+
+		if err != nil {
+			return "", err
+		}
+
+		path = filepath.Join(jm.IncompleteDirectoryPath, jm.drive.GetSanitizedName(resolvedName))
+	}
+
+	if err := gdrive.EnsureContained(jm.IncompleteDirectoryPath, path); err != nil {
+		return "", err
+	}
 
 	if err := os.MkdirAll(path, 0644); err != nil {
 		return "", err
@@ -22,57 +49,106 @@ func (jm *JobManager) createJobDirectory(driveFolder *drive.File) (string, error
 	return path, nil
 }
 
-func (jm *JobManager) setFileTargetPath(job *Job, driveFile *gdrive.DriveFile) {
-	driveFile.Path = filepath.Join(job.Path, driveFile.Path)
-}
+// isJobDirectoryInUse reports whether the directory already exists and does
+// not belong to the folder with the given id.
+func isJobDirectoryInUse(path string, driveId string) (bool, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return false, nil
+	}
 
-func createDownloadsDirectory(folderName string) (string, error) {
-	wd, err := os.Getwd()
+	buf, err := os.ReadFile(filepath.Join(path, driveIdFileName))
 
-	if err != nil {
-		return "", err
+	if os.IsNotExist(err) {
+		return true, nil
 	}
 
-	path := filepath.Join(wd, downloads, folderName)
-
-	if err := os.MkdirAll(path, 0644); err != nil {
-		return "", err
+	if err != nil {
+		return false, err
 	}
 
-	return path, nil
+	return string(buf) != driveId, nil
 }
 
-func (jm *JobManager) moveToCompletedDirectory(job *Job) error {
-	targetDirectoryPath := filepath.Join(jm.CompletedDirectoryPath, filepath.Base(job.Path))
+func (jm *JobManager) setFileTargetPath(job *Job, driveFile *gdrive.DriveFile) error {
+	path := filepath.Join(job.Path, driveFile.Path)
 
-	if err := os.MkdirAll(targetDirectoryPath, 0644); err != nil {
+	if err := gdrive.EnsureContained(job.Path, path); err != nil {
 		return err
 	}
 
-	items, err := os.ReadDir(job.Path)
+	driveFile.Path = path
 
-	if err != nil {
-		return err
+	return nil
+}
+
+// removeOrphanedPartFiles deletes part files and their hash states in the job
+// directory which do not belong to any of the files of the job, e.g. because
+// the file was removed from the folder or excluded by the job filter.
+func (jm *JobManager) removeOrphanedPartFiles(job *Job, files []*gdrive.DriveFile) error {
+	partFiles := make(map[string]bool)
+
+	for _, driveFile := range files {
+		partFiles[driveFile.PartPath()] = true
+		partFiles[driveFile.HashStatePath()] = true
 	}
 
-	for _, item := range items {
-		if item.Name() == driveIdFileName {
-			continue
+	return filepath.WalkDir(job.Path, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() || !isPartFile(path) || partFiles[path] {
+			return nil
+		}
+
+		jm.logger.Infof("removing orphaned part file '%s'", path)
+
+		return os.Remove(path)
+	})
+}
+
+// getFolders returns all folders which contain at least one of the files.
+func getFolders(files []*gdrive.DriveFile) []*gdrive.DriveFolder {
+	var folders []*gdrive.DriveFolder
+	known := make(map[*gdrive.DriveFolder]bool)
+
+	for _, driveFile := range files {
+		for folder := driveFile.Parent; folder != nil && !known[folder]; folder = folder.Parent {
+			known[folder] = true
+			folders = append(folders, folder)
 		}
+	}
+
+	return folders
+}
 
-		sourcePath := filepath.Join(job.Path, item.Name())
-		targetPath := filepath.Join(targetDirectoryPath, item.Name())
+// applyFolderTimes sets the modification times of the moved folders to the
+// ones of their Google Drive counterparts. It is done after the move since
+// moving files out of or into a folder changes its modification time.
+func (jm *JobManager) applyFolderTimes(job *Job) error {
+	if !jm.conf.Download.PreserveFolderTimes || job.folders == nil {
+		return nil
+	}
+
+	targetDirectoryPath := jm.getTargetDirectoryPath(job)
 
-		if err := os.Rename(sourcePath, targetPath); err != nil {
+	for _, folder := range job.folders {
+		err := gdrive.SetModifiedTime(filepath.Join(targetDirectoryPath, folder.Path), folder.Remote)
+
+		if err != nil && !os.IsNotExist(err) {
 			return err
 		}
 	}
 
-	if err = os.RemoveAll(job.Path); err != nil {
-		return err
+	return gdrive.SetModifiedTime(targetDirectoryPath, job.File)
+}
+
+func createDownloadsDirectory(path string) (string, error) {
+	if err := os.MkdirAll(path, 0644); err != nil {
+		return "", err
 	}
 
-	return nil
+	return path, nil
 }
 
 func (jm *JobManager) getSubfolders(path string) ([]string, error) {
@@ -94,3 +170,13 @@ func (jm *JobManager) getSubfolders(path string) ([]string, error) {
 
 	return names, nil
 }
+
+// isPartFile reports whether the path is the part file or the hash state of a
+// file which was not completed.
+func isPartFile(path string) bool {
+	return strings.HasSuffix(path, gdrive.PartFileSuffix) || strings.HasSuffix(path, gdrive.PartFileSuffix+gdrive.HashStateFileSuffix)
+}
+
+func isJobStateFile(name string) bool {
+	return name == driveIdFileName || name == jobFileName
+}
@@ -0,0 +1,24 @@
+package download
+
+import (
+	"fmt"
+	"time"
+)
+
+// HistoryEntry is a noteworthy event of a job.
+type HistoryEntry struct {
+	Time    time.Time
+	Message string
+	Output  string `json:",omitempty"`
+}
+
+func (job *Job) addHistory(format string, args ...interface{}) *HistoryEntry {
+	entry := &HistoryEntry{
+		Time:    time.Now(),
+		Message: fmt.Sprintf(format, args...),
+	}
+
+	job.History = append(job.History, entry)
+
+	return entry
+}
@@ -0,0 +1,125 @@
+package download
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/gogdl-ng/gogdl-ng/app/config"
+)
+
+const (
+	defaultHookTimeout = 300 * time.Second
+
+	// maxHookOutputLength limits the output of a hook which is stored in the
+	// job history.
+	maxHookOutputLength = 16 * 1024
+)
+
+// HookPayload describes a finished job. It is passed to hooks as json on stdin
+// and as environment variables.
+type HookPayload struct {
+	Id        string
+	Name      string
+	Path      string
+	FileCount int
+	TotalSize int64
+	Status    JobStatus
+}
+
+// runHooks runs the global hooks and the hooks of the category of the job.
+func (jm *JobManager) runHooks(job *Job, record *JobRecord) {
+	hooks := jm.conf.Hooks
+
+	if category, ok := jm.conf.Categories[job.Options.Category]; ok {
+		hooks = append(append([]config.HookConfiguration{}, hooks...), category.Hooks...)
+	}
+
+	for _, hook := range hooks {
+		payload := newHookPayload(job, record)
+		output, err := runHook(hook, payload)
+
+		if err == nil {
+			job.addHistory("hook '%s' succeeded", hook.Command).Output = output
+			continue
+		}
+
+		jm.logger.Errorf("hook '%s' of folder '%s' failed. %v", hook.Command, job.Id, err)
+		job.addHistory("hook '%s' failed. %v", hook.Command, err).Output = output
+
+		if hook.FailJob {
+			job.Status = JobStatusFailed
+		}
+	}
+}
+
+func newHookPayload(job *Job, record *JobRecord) *HookPayload {
+	payload := &HookPayload{
+		Id:     job.Id,
+		Name:   job.Name,
+		Path:   record.Path,
+		Status: job.Status,
+	}
+
+	failedFiles := make(map[string]bool)
+
+	for _, id := range job.FailedFiles {
+		failedFiles[id] = true
+	}
+
+	for _, entry := range job.Manifest {
+		if failedFiles[entry.Id] {
+			continue
+		}
+
+		payload.FileCount++
+		payload.TotalSize += entry.Size
+	}
+
+	return payload
+}
+
+func runHook(hook config.HookConfiguration, payload *HookPayload) (string, error) {
+	timeout := time.Duration(hook.Timeout) * time.Second
+
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+
+	stdin, err := json.Marshal(payload)
+
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command(hook.Command, hook.Args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Env = append(os.Environ(),
+		"GOGDL_JOB_ID="+payload.Id,
+		"GOGDL_JOB_NAME="+payload.Name,
+		"GOGDL_JOB_PATH="+payload.Path,
+		fmt.Sprintf("GOGDL_JOB_FILE_COUNT=%d", payload.FileCount),
+		fmt.Sprintf("GOGDL_JOB_TOTAL_SIZE=%d", payload.TotalSize),
+		"GOGDL_JOB_STATUS="+string(payload.Status),
+	)
+
+	output, err := runCommand(cmd, timeout)
+
+	if errors.Is(err, errCommandTimedOut) {
+		err = fmt.Errorf("hook timed out after %s", timeout)
+	}
+
+	return truncateOutput(output), err
+}
+
+func truncateOutput(output string) string {
+	if len(output) <= maxHookOutputLength {
+		return output
+	}
+
+	return output[len(output)-maxHookOutputLength:]
+}
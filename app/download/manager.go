@@ -1,6 +1,12 @@
 package download
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
 	"github.com/gogdl-ng/gogdl-ng/app/config"
 	"github.com/gogdl-ng/gogdl-ng/app/gdrive"
 	"github.com/gogdl-ng/gogdl-ng/app/logging"
@@ -9,16 +15,35 @@ import (
 )
 
 const (
-	downloads       string = "downloads"
-	completed       string = "completed"
-	incomplete      string = "incomplete"
 	driveIdFileName string = "driveId"
+	jobFileName     string = "job.json"
 )
 
+// ErrJobExists is returned when a job is created for a folder which already
+// has an unfinished job. Both jobs would use the same job directory.
+var ErrJobExists = errors.New("an unfinished job exists for the folder")
+
 type JobManager struct {
 	logger     logging.Logger
+	conf       *config.Configuration
 	drive      *gdrive.DriveService
 	dispatcher *Dispatcher
+	notifier   Notifier
+
+	mutex     sync.Mutex
+	cancelled map[string]bool
+	deferred  []*Job
+
+	// active contains the ids of the jobs which are queued or run by a
+	// worker. Other jobs are cancelled right away.
+	active map[string]bool
+
+	// createMutex prevents that two jobs are created for the same folder at
+	// the same time.
+	createMutex sync.Mutex
+
+	// targetMutex prevents that two jobs choose the same target directory.
+	targetMutex sync.Mutex
 
 	CompletedDirectoryPath  string
 	IncompleteDirectoryPath string
@@ -28,19 +53,106 @@ type Worker interface {
 	RunJob(job *Job)
 }
 
+type JobStatus string
+
+const (
+	JobStatusQueued    JobStatus = "queued"
+	JobStatusMoving    JobStatus = "moving"
+	JobStatusCompleted JobStatus = "completed"
+	JobStatusFailed    JobStatus = "failed"
+
+	// JobStatusDeferred jobs wait until the download quota of their files was
+	// reset or enough disk space is free.
+	JobStatusDeferred JobStatus = "deferred"
+)
+
 type Job struct {
-	Path string
+	Path     string
+	Status   JobStatus
+	Options  *JobOptions
+	Manifest []*ManifestEntry
 	*drive.File
+
+	// FailedFiles contains the ids of the files which failed to download.
+	FailedFiles []string
+	History     []*HistoryEntry
+
+	// FailedArchives contains the paths of the archives which could not be
+	// extracted.
+	FailedArchives []string
+
+	// DeferredUntil is the time a deferred job is queued again.
+	DeferredUntil time.Time
+
+	// CopiedFiles contains the paths of the files which were already copied
+	// to the target directory by an interrupted move.
+	CopiedFiles []string
+
+	// TargetPath is the directory in the completed directory or the one of
+	// the category which was chosen for the job before it was moved.
+	TargetPath string
+
+	folders []*gdrive.DriveFolder
 }
 
+// JobOptions are the user supplied settings of a job. They are persisted in
+// the job directory so they survive a restart.
+type JobOptions struct {
+	Filter *gdrive.Filter `json:",omitempty"`
+
+	// Category selects one of the configured categories whose path is used
+	// instead of the completed directory.
+	Category string `json:",omitempty"`
+
+	// Destination is the directory the content of the folder is moved to. A
+	// relative path is resolved against the completed directory. It has to be
+	// located inside of the completed directory or a category path unless
+	// any destination is allowed by the configuration.
+	Destination string `json:",omitempty"`
+
+	// FileIds restricts the job to the files with the given ids.
+	FileIds []string `json:",omitempty"`
+
+	// Mode defines whether all files are downloaded or only the ones which
+	// were added or changed since the last job of the folder.
+	Mode JobMode `json:",omitempty"`
+
+	// Extract enables the extraction of archives even when it is disabled in
+	// the configuration.
+	Extract bool `json:",omitempty"`
+
+	// Passwords are tried to extract encrypted archives. The job file is only
+	// readable by its owner while it contains them.
+	Passwords []string `json:",omitempty"`
+
+	// AcknowledgeAbuse downloads files which Google Drive flagged as malware
+	// or spam even when it is disabled in the configuration.
+	AcknowledgeAbuse bool `json:",omitempty"`
+}
+
+type JobMode string
+
+const (
+	// JobModeFull downloads all files of the folder.
+	JobModeFull JobMode = ""
+
+	// JobModeSync downloads the files which were added or changed since the
+	// last job of the folder into its target directory.
+	JobModeSync JobMode = "sync"
+
+	// JobModeMirror works like JobModeSync but additionally deletes the local
+	// files which were removed from the folder.
+	JobModeMirror JobMode = "mirror"
+)
+
 func NewJobManager(logger logging.Logger, conf *config.Configuration, drive *gdrive.DriveService) (*JobManager, error) {
-	completedDirectoryPath, err := createDownloadsDirectory(completed)
+	completedDirectoryPath, err := createDownloadsDirectory(conf.Paths.Completed)
 
 	if err != nil {
 		return nil, err
 	}
 
-	incompleteDirectoryPath, err := createDownloadsDirectory(incomplete)
+	incompleteDirectoryPath, err := createDownloadsDirectory(conf.Paths.Incomplete)
 
 	if err != nil {
 		return nil, err
@@ -48,7 +160,10 @@ func NewJobManager(logger logging.Logger, conf *config.Configuration, drive *gdr
 
 	service := &JobManager{
 		logger:                  logger,
+		conf:                    conf,
 		drive:                   drive,
+		cancelled:               make(map[string]bool),
+		active:                  make(map[string]bool),
 		CompletedDirectoryPath:  completedDirectoryPath,
 		IncompleteDirectoryPath: incompleteDirectoryPath,
 	}
@@ -65,8 +180,23 @@ func (jm *JobManager) Run() error {
 		return err
 	}
 
+	var queuedJobs []*Job
+
+	for _, job := range unfinishedJobs {
+		if job.Status == JobStatusDeferred {
+			jm.deferred = append(jm.deferred, job)
+			continue
+		}
+
+		queuedJobs = append(queuedJobs, job)
+	}
+
 	// todo: what when unfinished jobs > queueSize??
-	jm.dispatcher.AddJobs(unfinishedJobs)
+	for _, job := range queuedJobs {
+		jm.queueJob(job)
+	}
+
+	go jm.runDeferredJobs()
 
 	jm.dispatcher.Start(context.Background())
 	jm.dispatcher.Wait()
@@ -74,32 +204,222 @@ func (jm *JobManager) Run() error {
 	return nil
 }
 
+// queueJob hands the job to the dispatcher. The job is active until its run
+// is finished.
+func (jm *JobManager) queueJob(job *Job) {
+	jm.mutex.Lock()
+	jm.active[job.Id] = true
+	jm.mutex.Unlock()
+
+	jm.dispatcher.AddJob(job)
+}
+
 func (jm *JobManager) RunJob(job *Job) {
+	defer func() {
+		jm.mutex.Lock()
+		delete(jm.active, job.Id)
+		jm.mutex.Unlock()
+	}()
+
+	if job.Status == JobStatusMoving {
+		jm.logger.Infof("resuming interrupted move of folder: '%s'", job.Id)
+
+		if err := jm.FinishJob(job); err != nil {
+			jm.failJob(job, "finish job", err)
+		}
+
+		return
+	}
+
+	if jm.isCancelled(job.Id) {
+		jm.removeCancelledJob(job)
+		return
+	}
+
+	job.CopiedFiles = nil
+
 	files, err := jm.drive.GetFiles(job.File)
 
 	if err != nil {
-		jm.logger.Errorf("failed to retrieve files of folder: '%s'. %v", job.Id, err)
+		jm.failJob(job, "retrieve files", err)
+		return
+	}
+
+	files, skipped, err := jm.selectFiles(job.Options, files)
+
+	if err != nil {
+		jm.failJob(job, "filter files", err)
+		return
+	}
+
+	if len(skipped) > 0 {
+		jm.logger.Infof("skipping %d file(s) of folder '%s' because of the job filter", len(skipped), job.Id)
+	}
+
+	files, documents := splitGoogleDocuments(files)
+
+	if len(documents) > 0 {
+		jm.logger.Infof("skipping %d Google document(s) of folder '%s' because they can only be exported", len(documents), job.Id)
+	}
+
+	manifest := newManifest(files)
+	keepVerificationState(job.Manifest, manifest)
+
+	job.Manifest = manifest
+	job.folders = getFolders(files)
+
+	if job.Options.isSync() {
+		files, err = jm.getChangedFiles(job, files)
+
+		if err != nil {
+			jm.failJob(job, "determine changed files", err)
+			return
+		}
+	}
+
+	if err := jm.writeJobFile(job); err != nil {
+		jm.failJob(job, "write manifest", err)
 		return
 	}
 
 	for _, driveFile := range files {
-		jm.setFileTargetPath(job, driveFile)
+		if err := jm.setFileTargetPath(job, driveFile); err != nil {
+			jm.failJob(job, fmt.Sprintf("set target path of file '%s' (id: %s)", driveFile.Remote.Name, driveFile.Remote.Id), err)
+			return
+		}
+	}
+
+	if err := jm.removeOrphanedPartFiles(job, files); err != nil {
+		jm.logger.Errorf("failed to remove orphaned part files of folder: '%s'. %v", job.Id, err)
+	}
+
+	if err := jm.checkDiskSpace(job, files); err != nil {
+		if errors.Is(err, ErrNotEnoughDiskSpace) {
+			jm.deferJob(job, jm.getDiskSpaceRecheckDelay(), err.Error())
+			return
+		}
+
+		jm.failJob(job, "check disk space", err)
+		return
+	}
+
+	job.FailedFiles = nil
+	quotaExceeded := false
+
+	for _, driveFile := range files {
+		if jm.isCancelled(job.Id) {
+			jm.removeCancelledJob(job)
+			return
+		}
+
+		driveFile.AcknowledgeAbuse = jm.conf.GDrive.AcknowledgeAbuse || job.Options.AcknowledgeAbuse
+		driveFile.Cancelled = func() bool { return jm.isCancelled(job.Id) }
+		driveFile.VerifiedWith = getVerified(job.Manifest, driveFile)
+
+		err := jm.drive.DownloadFile(driveFile)
+
+		if errors.Is(err, gdrive.ErrCancelled) {
+			jm.removeCancelledJob(job)
+			return
+		}
+
+		if driveFile.PreviousRemote != nil {
+			replaceManifestEntry(job.Manifest, driveFile)
+			job.addHistory("file '%s' was replaced in Google Drive while the job was running (id: %s -> %s, size: %d -> %d). downloading it again",
+				driveFile.RemotePath, driveFile.PreviousRemote.Id, driveFile.Remote.Id, driveFile.PreviousRemote.Size, driveFile.Remote.Size)
+		}
+
+		if driveFile.AbuseAcknowledged {
+			job.addHistory("file '%s' was flagged as malware or spam by Google Drive and downloaded anyway", driveFile.RemotePath)
+		}
+
+		if err != nil {
+			reason := gdrive.ClassifyError(err).Reason
+
+			jm.logger.Errorf("failed to download file (name: %s, id: %s, reason: %s). %v", driveFile.Remote.Name, driveFile.Remote.Id, reason, err)
+			job.FailedFiles = append(job.FailedFiles, driveFile.Remote.Id)
+			job.addHistory("failed to download file '%s' (reason: %s). %v", driveFile.RemotePath, reason, err)
+
+			if isDownloadQuotaExceeded(err) {
+				quotaExceeded = true
+			}
+
+			continue
+		}
 
-		if err := jm.drive.DownloadFile(driveFile); err != nil {
-			jm.logger.Errorf("failed to download file (name: %s, id: %s). %v", driveFile.Remote.Name, driveFile.Remote.Id, err)
+		if len(driveFile.VerifiedWith) > 0 {
+			setVerified(job.Manifest, driveFile)
 		}
 	}
 
-	jm.FinishJob(job)
+	if quotaExceeded {
+		jm.deferJob(job, jm.getQuotaExceededDelay(), fmt.Sprintf("download quota of %d file(s) exceeded", len(job.FailedFiles)))
+		return
+	}
+
+	if jm.shouldExtract(job) {
+		if len(job.FailedFiles) > 0 {
+			job.addHistory("skipped extraction of archives because not all files were downloaded")
+		} else if err := jm.extractArchives(job); err != nil {
+			jm.logger.Errorf("failed to extract archives of folder: '%s'. %v", job.Id, err)
+			job.addHistory("failed to extract archives. %v", err)
+
+			// the job directory itself stands for all of its archives.
+			job.FailedArchives = append(job.FailedArchives, ".")
+		}
+	}
+
+	if err := jm.FinishJob(job); err != nil {
+		jm.failJob(job, "finish job", err)
+	}
+}
+
+// failJob handles a job which had to be aborted. The job is retried after a
+// delay, since most of the failures are caused by Google Drive or the network.
+// It can be cancelled in the meantime.
+func (jm *JobManager) failJob(job *Job, action string, err error) {
+	jm.logger.Errorf("failed to %s of folder: '%s'. %v", action, job.Id, err)
+
+	status := job.Status
+	job.Status = JobStatusFailed
+	jm.notify(EventJobFailed, job, job.Path, "Job '%s' failed to %s. %v", job.Name, action, err)
+	job.Status = status
+
+	// the job directory is already gone when only the record could not be
+	// written.
+	if _, err := os.Stat(job.Path); os.IsNotExist(err) {
+		return
+	}
+
+	jm.deferJob(job, failedJobRetryDelay, fmt.Sprintf("failed to %s. %v", action, err))
 }
 
-func (jm *JobManager) CreateJob(driveId string) error {
+func (jm *JobManager) CreateJob(driveId string, options *JobOptions) error {
+	if options == nil {
+		options = &JobOptions{}
+	}
+
+	if err := jm.ValidateOptions(options); err != nil {
+		return err
+	}
+
 	folder, err := jm.drive.GetFolder(driveId)
 
 	if err != nil {
 		return err
 	}
 
+	if err := jm.setSyncDestination(driveId, options); err != nil {
+		return err
+	}
+
+	jm.createMutex.Lock()
+	defer jm.createMutex.Unlock()
+
+	if _, err := jm.getJobDirectoryPath(folder.Id); err == nil {
+		return fmt.Errorf("%w (driveId: %s)", ErrJobExists, folder.Id)
+	}
+
 	path, err := jm.createJobDirectory(folder)
 
 	if err != nil {
@@ -107,20 +427,83 @@ func (jm *JobManager) CreateJob(driveId string) error {
 	}
 
 	job := &Job{
-		Path: path,
-		File: folder,
+		Path:    path,
+		Status:  JobStatusQueued,
+		Options: options,
+		File:    folder,
 	}
 
-	jm.dispatcher.AddJob(job)
+	if err := jm.writeJobFile(job); err != nil {
+		return err
+	}
+
+	jm.mutex.Lock()
+	delete(jm.cancelled, driveId)
+	jm.mutex.Unlock()
+
+	jm.notify(EventJobCreated, job, path, "Job '%s' was created.", job.Name)
+	jm.queueJob(job)
 
 	return nil
 }
 
 func (jm *JobManager) FinishJob(job *Job) error {
+	// an interrupted move already chose its target directory.
+	if job.Status != JobStatusMoving {
+		if err := jm.resolveTargetDirectoryPath(job); err != nil {
+			return err
+		}
+	}
+
+	job.Status = JobStatusMoving
+	job.addHistory("moving folder to '%s'", jm.getTargetDirectoryPath(job))
+
+	if err := jm.writeJobFile(job); err != nil {
+		return err
+	}
+
 	if err := jm.moveToCompletedDirectory(job); err != nil {
+		jm.logger.Errorf("failed to move folder '%s' to the completed directory. %v", job.Id, err)
 		return err
 	}
 
+	job.Status = JobStatusCompleted
+
+	if len(job.FailedFiles) > 0 || len(job.FailedArchives) > 0 {
+		job.Status = JobStatusFailed
+	}
+
+	record, err := jm.saveJobRecord(job)
+
+	if err != nil {
+		jm.logger.Errorf("failed to save record of folder '%s'. %v", job.Id, err)
+		return err
+	}
+
+	if err := jm.writeChecksumManifest(record); err != nil {
+		jm.logger.Errorf("failed to write checksum manifest of folder '%s'. %v", job.Id, err)
+	}
+
+	if err := jm.applyFolderTimes(job); err != nil {
+		jm.logger.Errorf("failed to set modification times of folder '%s'. %v", job.Id, err)
+	}
+
+	jm.runHooks(job, record)
+
+	record.Status = job.Status
+	record.History = job.History
+
+	if err := jm.writeJobRecord(record); err != nil {
+		jm.logger.Errorf("failed to save record of folder '%s'. %v", job.Id, err)
+		return err
+	}
+
+	if job.Status == JobStatusFailed {
+		jm.notify(EventJobFailed, job, record.Path, "Job '%s' failed.", job.Name)
+	} else {
+		jm.notify(EventJobCompleted, job, record.Path, "Job '%s' was completed.", job.Name)
+	}
+
 	return nil
 }
 
@@ -147,11 +530,104 @@ func (jm *JobManager) getNotCompletedJobs() ([]*Job, error) {
 			continue
 		}
 
+		state, err := jm.readJobFile(path)
+
+		if err != nil {
+			continue
+		}
+
 		jobs = append(jobs, &Job{
-			File: folder,
-			Path: path,
+			File:           folder,
+			Status:         state.Status,
+			Options:        state.Options,
+			Manifest:       state.Manifest,
+			FailedFiles:    state.FailedFiles,
+			FailedArchives: state.FailedArchives,
+			DeferredUntil:  state.DeferredUntil,
+			CopiedFiles:    state.CopiedFiles,
+			TargetPath:     state.TargetPath,
+			History:        state.History,
+			Path:           path,
 		})
 	}
 
 	return jobs, nil
 }
+
+// ValidateOptions checks whether the options can be used to create a job.
+func (jm *JobManager) ValidateOptions(options *JobOptions) error {
+	if err := options.Filter.Validate(); err != nil {
+		return err
+	}
+
+	if len(options.Category) > 0 {
+		if _, ok := jm.conf.Categories[options.Category]; !ok {
+			return fmt.Errorf("unknown category '%s'", options.Category)
+		}
+	}
+
+	switch options.Mode {
+	case JobModeFull, JobModeSync, JobModeMirror:
+	default:
+		return fmt.Errorf("unknown job mode '%s'", options.Mode)
+	}
+
+	if len(options.Destination) > 0 {
+		if err := jm.validateDestination(options.Destination); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splitGoogleDocuments separates the Google Docs, Sheets etc. documents from
+// the files which have a binary content.
+func splitGoogleDocuments(files []*gdrive.DriveFile) ([]*gdrive.DriveFile, []*gdrive.DriveFile) {
+	var binaryFiles []*gdrive.DriveFile
+	var documents []*gdrive.DriveFile
+
+	for _, driveFile := range files {
+		if driveFile.IsGoogleDocument() {
+			documents = append(documents, driveFile)
+			continue
+		}
+
+		binaryFiles = append(binaryFiles, driveFile)
+	}
+
+	return binaryFiles, documents
+}
+
+func (jm *JobManager) getFilter(options *JobOptions) *gdrive.Filter {
+	return options.Filter.WithDefaults(jm.conf.GDrive.Filter)
+}
+
+// selectFiles splits the files into the ones which are part of the job and the
+// ones which are skipped because of the job filter or file ids.
+func (jm *JobManager) selectFiles(options *JobOptions, files []*gdrive.DriveFile) ([]*gdrive.DriveFile, []*gdrive.DriveFile, error) {
+	kept, skipped, err := jm.getFilter(options).Apply(files)
+
+	if err != nil || len(options.FileIds) == 0 {
+		return kept, skipped, err
+	}
+
+	fileIds := make(map[string]bool)
+
+	for _, id := range options.FileIds {
+		fileIds[id] = true
+	}
+
+	var selected []*gdrive.DriveFile
+
+	for _, driveFile := range kept {
+		if fileIds[driveFile.Remote.Id] {
+			selected = append(selected, driveFile)
+			continue
+		}
+
+		skipped = append(skipped, driveFile)
+	}
+
+	return selected, skipped, nil
+}
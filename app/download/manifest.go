@@ -0,0 +1,114 @@
+package download
+
+import (
+	"path/filepath"
+
+	"github.com/gogdl-ng/gogdl-ng/app/gdrive"
+)
+
+// ManifestEntry records where a file of the folder is stored locally. The
+// local path differs from the remote path when a name had to be sanitized or
+// was already used by another item.
+type ManifestEntry struct {
+	Id             string
+	RemotePath     string
+	Path           string
+	Size           int64
+	Md5Checksum    string
+	Sha1Checksum   string `json:",omitempty"`
+	Sha256Checksum string `json:",omitempty"`
+	CreatedTime    string `json:",omitempty"`
+	ModifiedTime   string `json:",omitempty"`
+	Description    string `json:",omitempty"`
+
+	// VerifiedWith is the algorithm whose checksum was verified after the
+	// file was downloaded.
+	VerifiedWith string `json:",omitempty"`
+
+	// ExtractedFiles are the files which were extracted from the archive.
+	ExtractedFiles []string `json:",omitempty"`
+
+	// Removed is set when the file was deleted after its archive was
+	// extracted.
+	Removed bool `json:",omitempty"`
+}
+
+func newManifest(files []*gdrive.DriveFile) []*ManifestEntry {
+	var manifest []*ManifestEntry
+
+	for _, driveFile := range files {
+		manifest = append(manifest, &ManifestEntry{
+			Id:             driveFile.Remote.Id,
+			RemotePath:     driveFile.RemotePath,
+			Path:           filepath.ToSlash(driveFile.Path),
+			Size:           driveFile.Remote.Size,
+			Md5Checksum:    driveFile.Remote.Md5Checksum,
+			Sha1Checksum:   driveFile.Remote.Sha1Checksum,
+			Sha256Checksum: driveFile.Remote.Sha256Checksum,
+			CreatedTime:    driveFile.Remote.CreatedTime,
+			ModifiedTime:   driveFile.Remote.ModifiedTime,
+			Description:    driveFile.Remote.Description,
+		})
+	}
+
+	return manifest
+}
+
+// keepVerificationState copies the verified algorithm of unchanged files from
+// an earlier manifest of the folder, since completed files are not verified
+// again.
+func keepVerificationState(previous []*ManifestEntry, manifest []*ManifestEntry) {
+	previousEntries := make(map[string]*ManifestEntry)
+
+	for _, entry := range previous {
+		previousEntries[entry.Id] = entry
+	}
+
+	for _, entry := range manifest {
+		previousEntry, ok := previousEntries[entry.Id]
+
+		if ok && len(entry.VerifiedWith) == 0 && previousEntry.Md5Checksum == entry.Md5Checksum {
+			entry.VerifiedWith = previousEntry.VerifiedWith
+		}
+	}
+}
+
+// replaceManifestEntry updates the entry of a file which was replaced in
+// Google Drive while the job was running.
+func replaceManifestEntry(manifest []*ManifestEntry, driveFile *gdrive.DriveFile) {
+	for _, entry := range manifest {
+		if entry.Id != driveFile.PreviousRemote.Id {
+			continue
+		}
+
+		entry.Id = driveFile.Remote.Id
+		entry.Size = driveFile.Remote.Size
+		entry.Md5Checksum = driveFile.Remote.Md5Checksum
+		entry.Sha1Checksum = driveFile.Remote.Sha1Checksum
+		entry.Sha256Checksum = driveFile.Remote.Sha256Checksum
+		entry.CreatedTime = driveFile.Remote.CreatedTime
+		entry.ModifiedTime = driveFile.Remote.ModifiedTime
+		entry.Description = driveFile.Remote.Description
+	}
+}
+
+// getVerified returns the algorithm which verified the file in an earlier run
+// of the job.
+func getVerified(manifest []*ManifestEntry, driveFile *gdrive.DriveFile) string {
+	for _, entry := range manifest {
+		if entry.Id == driveFile.Remote.Id {
+			return entry.VerifiedWith
+		}
+	}
+
+	return ""
+}
+
+// setVerified records the algorithm which verified the file.
+func setVerified(manifest []*ManifestEntry, driveFile *gdrive.DriveFile) {
+	for _, entry := range manifest {
+		if entry.Id == driveFile.Remote.Id {
+			entry.VerifiedWith = driveFile.VerifiedWith
+		}
+	}
+}
@@ -0,0 +1,464 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/gogdl-ng/gogdl-ng/app/disk"
+	"github.com/gogdl-ng/gogdl-ng/app/gdrive"
+)
+
+const (
+	moveVerificationChecksum = "checksum"
+
+	// modTimeTolerance covers file systems which store modification times
+	// with a low resolution, e.g. FAT and some network shares.
+	modTimeTolerance = 2 * time.Second
+)
+
+// moveProgress keeps track of the files which had to be copied because the
+// completed directory is located on another volume.
+type moveProgress struct {
+	job        *Job
+	totalSize  int64
+	copiedSize int64
+	copied     map[string]bool
+
+	// files contains the paths of the files of the manifest, so a file whose
+	// name looks like a part file is not mistaken for one.
+	files map[string]bool
+}
+
+func (jm *JobManager) newMoveProgress(job *Job, totalSize int64) *moveProgress {
+	progress := &moveProgress{job: job, totalSize: totalSize, copied: make(map[string]bool), files: make(map[string]bool)}
+
+	for _, path := range job.CopiedFiles {
+		progress.copied[path] = true
+	}
+
+	for _, entry := range job.Manifest {
+		progress.files[entry.Path] = true
+
+		for _, path := range entry.ExtractedFiles {
+			progress.files[path] = true
+		}
+	}
+
+	return progress
+}
+
+func (progress *moveProgress) getRelativePath(sourcePath string) string {
+	relativePath, err := filepath.Rel(progress.job.Path, sourcePath)
+
+	if err != nil {
+		return sourcePath
+	}
+
+	return filepath.ToSlash(relativePath)
+}
+
+// markCopied records the copied file in the job file, so an interrupted move
+// does not copy it again.
+func (jm *JobManager) markCopied(progress *moveProgress, sourcePath string) error {
+	relativePath := progress.getRelativePath(sourcePath)
+
+	progress.copied[relativePath] = true
+	progress.job.CopiedFiles = append(progress.job.CopiedFiles, relativePath)
+
+	return jm.writeJobFile(progress.job)
+}
+
+func (jm *JobManager) moveToCompletedDirectory(job *Job) error {
+	targetDirectoryPath := jm.getTargetDirectoryPath(job)
+
+	if err := os.MkdirAll(targetDirectoryPath, 0644); err != nil {
+		return err
+	}
+
+	items, err := os.ReadDir(job.Path)
+
+	if err != nil {
+		return err
+	}
+
+	totalSize, err := getDirectorySize(job.Path)
+
+	if err != nil {
+		return err
+	}
+
+	progress := jm.newMoveProgress(job, totalSize)
+
+	for _, item := range items {
+		if isJobStateFile(item.Name()) {
+			continue
+		}
+
+		sourcePath := filepath.Join(job.Path, item.Name())
+		targetPath := filepath.Join(targetDirectoryPath, item.Name())
+
+		if err := jm.move(sourcePath, targetPath, progress); err != nil {
+			return err
+		}
+	}
+
+	if err = os.RemoveAll(job.Path); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// getTargetDirectoryPath returns the directory the content of the job is moved
+// to. It is the explicit destination of the job, or a folder named after the
+// job in the directory of its category or the completed directory. The name of
+// the folder can differ once the target directory was resolved.
+func (jm *JobManager) getTargetDirectoryPath(job *Job) string {
+	if len(job.Options.Destination) > 0 {
+		return jm.resolveDestination(job.Options.Destination)
+	}
+
+	if len(job.TargetPath) > 0 {
+		return job.TargetPath
+	}
+
+	return filepath.Join(jm.getParentDirectoryPath(job), filepath.Base(job.Path))
+}
+
+func (jm *JobManager) getParentDirectoryPath(job *Job) string {
+	if category, ok := jm.conf.Categories[job.Options.Category]; ok {
+		return category.Path
+	}
+
+	return jm.CompletedDirectoryPath
+}
+
+// resolveTargetDirectoryPath chooses the folder of a job without an explicit
+// destination. A folder which is used by another Google Drive folder gets a
+// name according to the collision strategy, so the content of both folders is
+// not mixed up. The chosen folder is created right away, so no other job can
+// choose it as well.
+func (jm *JobManager) resolveTargetDirectoryPath(job *Job) error {
+	if len(job.Options.Destination) > 0 || len(job.TargetPath) > 0 {
+		return nil
+	}
+
+	jm.targetMutex.Lock()
+	defer jm.targetMutex.Unlock()
+
+	parentDirectoryPath := jm.getParentDirectoryPath(job)
+	name := filepath.Base(job.Path)
+	path := filepath.Join(parentDirectoryPath, name)
+
+	for n := 1; ; n++ {
+		inUse, err := jm.isTargetDirectoryInUse(path, job.Id)
+
+		if err != nil {
+			return err
+		}
+
+		if !inUse {
+			break
+		}
+
+		resolvedName, err := gdrive.ResolveNameCollision(name, job.Id, n, false, jm.conf.Download.CollisionStrategy)
+
+		if err != nil {
+			return err
+		}
+
+		path = filepath.Join(parentDirectoryPath, jm.drive.GetSanitizedName(resolvedName))
+	}
+
+	if err := gdrive.EnsureContained(parentDirectoryPath, path); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(path, 0644); err != nil {
+		return err
+	}
+
+	if path != filepath.Join(parentDirectoryPath, name) {
+		jm.logger.Warnf("moving folder '%s' to '%s' because its name is already used by another folder", job.Id, path)
+	}
+
+	job.TargetPath = path
+
+	return nil
+}
+
+// isTargetDirectoryInUse reports whether the directory already exists and is
+// not the target directory of an earlier job of the same folder.
+func (jm *JobManager) isTargetDirectoryInUse(path string, driveId string) (bool, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return false, nil
+	}
+
+	record, err := jm.ReadJobRecord(driveId)
+
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return record.Path != path, nil
+}
+
+// resolveDestination resolves a relative destination against the completed
+// directory.
+func (jm *JobManager) resolveDestination(destination string) string {
+	if filepath.IsAbs(destination) {
+		return filepath.Clean(destination)
+	}
+
+	return filepath.Join(jm.CompletedDirectoryPath, destination)
+}
+
+// validateDestination ensures that the destination is located inside of the
+// completed directory or the path of a category, unless any destination is
+// allowed by the configuration.
+func (jm *JobManager) validateDestination(destination string) error {
+	if jm.conf.Download.AllowAnyDestination {
+		return nil
+	}
+
+	path := jm.resolveDestination(destination)
+	roots := []string{jm.CompletedDirectoryPath}
+
+	for _, category := range jm.conf.Categories {
+		roots = append(roots, category.Path)
+	}
+
+	for _, root := range roots {
+		if err := gdrive.EnsureContained(root, path); err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("destination '%s' is not located inside of the completed directory or a category path", destination)
+}
+
+// move renames the source to the target. Directories are merged into an
+// already existing target directory. When source and target are located on
+// different volumes the source is copied, verified and deleted afterwards.
+// Files which were already copied by an interrupted move are not copied again.
+// Leftovers of files which failed to download are deleted instead.
+func (jm *JobManager) move(sourcePath string, targetPath string, progress *moveProgress) error {
+	info, err := os.Stat(sourcePath)
+
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() && isPartFile(sourcePath) && !progress.files[progress.getRelativePath(sourcePath)] {
+		jm.logger.Infof("removing part file '%s' of a failed download", sourcePath)
+		return os.Remove(sourcePath)
+	}
+
+	if info.IsDir() {
+		if targetInfo, err := os.Stat(targetPath); err == nil && targetInfo.IsDir() {
+			return jm.moveDirectoryContent(sourcePath, targetPath, progress)
+		}
+	}
+
+	// a rename across volumes fails with EXDEV on unix, but with another error
+	// on windows.
+	sameVolume, err := disk.SameVolume(filepath.Dir(sourcePath), filepath.Dir(targetPath))
+
+	if err != nil {
+		return err
+	}
+
+	if sameVolume {
+		err = os.Rename(sourcePath, targetPath)
+
+		// bind mounts of the same file system can not be renamed across either.
+		if err == nil || !errors.Is(err, syscall.EXDEV) {
+			return err
+		}
+	}
+
+	if info.IsDir() {
+		if err := os.MkdirAll(targetPath, info.Mode().Perm()); err != nil {
+			return err
+		}
+
+		return jm.moveDirectoryContent(sourcePath, targetPath, progress)
+	}
+
+	return jm.moveFileAcrossVolumes(sourcePath, targetPath, info, progress)
+}
+
+func (jm *JobManager) moveDirectoryContent(sourcePath string, targetPath string, progress *moveProgress) error {
+	items, err := os.ReadDir(sourcePath)
+
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := jm.move(filepath.Join(sourcePath, item.Name()), filepath.Join(targetPath, item.Name()), progress); err != nil {
+			return err
+		}
+	}
+
+	return os.Remove(sourcePath)
+}
+
+// moveFileAcrossVolumes copies the file and deletes it afterwards. An existing
+// target is only kept when the file was copied by an interrupted move, since
+// it can also be an older version of the file, e.g. when a sync job or a
+// verification downloads it again.
+func (jm *JobManager) moveFileAcrossVolumes(sourcePath string, targetPath string, info fs.FileInfo, progress *moveProgress) error {
+	var copied bool
+	var err error
+
+	if progress.copied[progress.getRelativePath(sourcePath)] {
+		if copied, err = jm.verifyCopy(sourcePath, targetPath); err != nil {
+			return err
+		}
+	}
+
+	if !copied {
+		if err := copyFile(sourcePath, targetPath, info); err != nil {
+			return err
+		}
+
+		copied, err = jm.verifyCopy(sourcePath, targetPath)
+
+		if err != nil {
+			return err
+		}
+
+		if !copied {
+			return fmt.Errorf("verification of copied file '%s' failed", targetPath)
+		}
+
+		if err := jm.markCopied(progress, sourcePath); err != nil {
+			return err
+		}
+	}
+
+	progress.copiedSize += info.Size()
+	jm.logger.Infof("copied '%s' to '%s' (%d of %d bytes)", sourcePath, targetPath, progress.copiedSize, progress.totalSize)
+
+	return os.Remove(sourcePath)
+}
+
+// verifyCopy reports whether the target is an identical copy of the source.
+func (jm *JobManager) verifyCopy(sourcePath string, targetPath string) (bool, error) {
+	sourceInfo, err := os.Stat(sourcePath)
+
+	if err != nil {
+		return false, err
+	}
+
+	targetInfo, err := os.Stat(targetPath)
+
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	// copyFile preserves the modification time, so a target with another one
+	// is not a copy of the source.
+	if sourceInfo.Size() != targetInfo.Size() || !isSameModTime(sourceInfo.ModTime(), targetInfo.ModTime()) {
+		return false, nil
+	}
+
+	if jm.conf.Download.MoveVerification != moveVerificationChecksum {
+		return true, nil
+	}
+
+	sourceChecksum, err := gdrive.GetMd5Checksum(sourcePath)
+
+	if err != nil {
+		return false, err
+	}
+
+	targetChecksum, err := gdrive.GetMd5Checksum(targetPath)
+
+	if err != nil {
+		return false, err
+	}
+
+	return sourceChecksum == targetChecksum, nil
+}
+
+func isSameModTime(a time.Time, b time.Time) bool {
+	difference := a.Sub(b)
+
+	return difference > -modTimeTolerance && difference < modTimeTolerance
+}
+
+// copyFile copies the file to a temporary file next to the target which is
+// renamed once the content was written completely.
+func copyFile(sourcePath string, targetPath string, info fs.FileInfo) error {
+	source, err := os.Open(sourcePath)
+
+	if err != nil {
+		return err
+	}
+
+	defer source.Close()
+
+	temporaryPath := targetPath + gdrive.PartFileSuffix
+	target, err := os.OpenFile(temporaryPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(target, source); err != nil {
+		target.Close()
+		return err
+	}
+
+	if err := target.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chtimes(temporaryPath, info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+
+	return os.Rename(temporaryPath, targetPath)
+}
+
+func getDirectorySize(path string) (int64, error) {
+	var size int64
+
+	err := filepath.WalkDir(path, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+
+		if err != nil {
+			return err
+		}
+
+		size += info.Size()
+
+		return nil
+	})
+
+	return size, err
+}
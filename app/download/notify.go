@@ -0,0 +1,42 @@
+package download
+
+import "fmt"
+
+const (
+	EventJobCreated   = "job.created"
+	EventJobCompleted = "job.completed"
+	EventJobFailed    = "job.failed"
+	EventJobCancelled = "job.cancelled"
+)
+
+// Notifier receives the lifecycle events of jobs.
+type Notifier interface {
+	Notify(event string, message string, data interface{})
+}
+
+// JobEvent is the data of a job lifecycle event.
+type JobEvent struct {
+	Id     string
+	Name   string
+	Path   string
+	Status JobStatus
+}
+
+func (jm *JobManager) SetNotifier(notifier Notifier) {
+	jm.notifier = notifier
+}
+
+func (jm *JobManager) notify(event string, job *Job, path string, format string, args ...interface{}) {
+	if jm.notifier == nil {
+		return
+	}
+
+	data := &JobEvent{
+		Id:     job.Id,
+		Name:   job.Name,
+		Path:   path,
+		Status: job.Status,
+	}
+
+	jm.notifier.Notify(event, fmt.Sprintf(format, args...), data)
+}
@@ -0,0 +1,146 @@
+package download
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/gogdl-ng/gogdl-ng/app/disk"
+	"github.com/gogdl-ng/gogdl-ng/app/gdrive"
+)
+
+type PreviewFile struct {
+	Path     string
+	Size     int64
+	MimeType string
+}
+
+type PreviewNode struct {
+	Name     string
+	Size     int64
+	Children []*PreviewNode `json:",omitempty"`
+}
+
+// Preview describes what a job would download without downloading anything.
+type Preview struct {
+	Name       string
+	Tree       *PreviewNode
+	TotalSize  int64
+	FileCount  int
+	Exportable []*PreviewFile
+	Skipped    []*PreviewFile
+	FreeSpace  uint64
+
+	// ReservedSpace is the part of the free space which has to stay free.
+	ReservedSpace uint64
+	Warnings      []string
+}
+
+func (jm *JobManager) Preview(driveId string, options *JobOptions) (*Preview, error) {
+	if options == nil {
+		options = &JobOptions{}
+	}
+
+	if err := jm.ValidateOptions(options); err != nil {
+		return nil, err
+	}
+
+	folder, err := jm.drive.GetFolder(driveId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := jm.drive.GetFiles(folder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	kept, skipped, err := jm.selectFiles(options, files)
+
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &Preview{
+		Name:       folder.Name,
+		Tree:       &PreviewNode{Name: folder.Name},
+		Exportable: []*PreviewFile{},
+		Skipped:    newPreviewFiles(skipped),
+		Warnings:   []string{},
+	}
+
+	for _, driveFile := range kept {
+		if driveFile.IsGoogleDocument() {
+			preview.Exportable = append(preview.Exportable, newPreviewFile(driveFile))
+			continue
+		}
+
+		preview.Tree.add(strings.Split(filepath.ToSlash(driveFile.Path), "/"), driveFile.Remote.Size)
+		preview.TotalSize += driveFile.Remote.Size
+		preview.FileCount++
+	}
+
+	freeSpace, err := disk.FreeSpace(jm.IncompleteDirectoryPath)
+
+	if err != nil {
+		jm.logger.Errorf("failed to determine free disk space. %v", err)
+		preview.Warnings = append(preview.Warnings, "failed to determine free disk space")
+
+		return preview, nil
+	}
+
+	preview.FreeSpace = freeSpace
+	preview.ReservedSpace = jm.conf.Download.ReservedDiskSpace * disk.Megabyte
+
+	// the same check refuses to start the job.
+	if uint64(preview.TotalSize)+preview.ReservedSpace > freeSpace {
+		preview.Warnings = append(preview.Warnings, fmt.Sprintf("folder needs %d bytes but only %d bytes are free in '%s' (reserve: %d bytes)",
+			preview.TotalSize, freeSpace, jm.IncompleteDirectoryPath, preview.ReservedSpace))
+	}
+
+	return preview, nil
+}
+
+func (node *PreviewNode) add(segments []string, size int64) {
+	node.Size += size
+
+	if len(segments) == 0 {
+		return
+	}
+
+	var child *PreviewNode
+
+	for _, c := range node.Children {
+		if c.Name == segments[0] {
+			child = c
+			break
+		}
+	}
+
+	if child == nil {
+		child = &PreviewNode{Name: segments[0]}
+		node.Children = append(node.Children, child)
+	}
+
+	child.add(segments[1:], size)
+}
+
+func newPreviewFiles(files []*gdrive.DriveFile) []*PreviewFile {
+	previewFiles := []*PreviewFile{}
+
+	for _, driveFile := range files {
+		previewFiles = append(previewFiles, newPreviewFile(driveFile))
+	}
+
+	return previewFiles
+}
+
+func newPreviewFile(driveFile *gdrive.DriveFile) *PreviewFile {
+	return &PreviewFile{
+		Path:     filepath.ToSlash(driveFile.Path),
+		Size:     driveFile.Remote.Size,
+		MimeType: driveFile.Remote.MimeType,
+	}
+}
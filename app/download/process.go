@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package download
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts the command in its own session and therefore its own
+// process group, so it can be killed together with its children. Without a
+// controlling terminal prompts like the one of 7-Zip for a password read from
+// stdin instead of the terminal.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	// the process group id equals the pid of the command.
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		cmd.Process.Kill()
+	}
+}
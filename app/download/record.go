@@ -0,0 +1,165 @@
+package download
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const recordsFolderName = "jobs"
+
+// JobRecord is stored in the state directory once a job was moved to its
+// target directory. It is used to find the files of a job again.
+type JobRecord struct {
+	DriveId     string
+	Name        string
+	Path        string
+	Status      JobStatus
+	CompletedAt time.Time
+	Options     *JobOptions
+	Manifest    []*ManifestEntry
+	History     []*HistoryEntry
+}
+
+// saveJobRecord writes the record of the finished job. When the job was moved
+// into the target directory of an earlier job of the same folder, e.g. because
+// only some of its files were downloaded again, the manifests are merged.
+func (jm *JobManager) saveJobRecord(job *Job) (*JobRecord, error) {
+	record := &JobRecord{
+		DriveId:     job.Id,
+		Name:        job.Name,
+		Path:        jm.getTargetDirectoryPath(job),
+		Status:      job.Status,
+		CompletedAt: time.Now(),
+		Options:     job.Options,
+		Manifest:    job.Manifest,
+		History:     job.History,
+	}
+
+	previousRecord, err := jm.ReadJobRecord(job.Id)
+
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if previousRecord != nil && previousRecord.Path == record.Path {
+		if job.Options.Mode == JobModeMirror && len(job.Options.FileIds) == 0 {
+			if err := jm.removeDeletedFiles(previousRecord, job.Manifest); err != nil {
+				return nil, err
+			}
+		} else {
+			record.Manifest = mergeManifests(previousRecord.Manifest, job.Manifest)
+		}
+
+		if len(job.Options.FileIds) > 0 {
+			record.Options = previousRecord.Options
+		}
+
+		keepExtractionState(previousRecord.Manifest, record.Manifest)
+		keepVerificationState(previousRecord.Manifest, record.Manifest)
+	}
+
+	if len(record.Options.Passwords) > 0 {
+		options := *record.Options
+		options.Passwords = nil
+		record.Options = &options
+	}
+
+	if err := jm.writeJobRecord(record); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+func (jm *JobManager) writeJobRecord(record *JobRecord) error {
+	buf, err := json.MarshalIndent(record, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(jm.getRecordsDirectoryPath(), 0644); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(jm.getRecordPath(record.DriveId), buf, 0644); err != nil {
+		jm.logger.Errorf("failed to write job record. %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// ReadJobRecord reads the record of the last finished job of the folder with
+// the given id.
+func (jm *JobManager) ReadJobRecord(driveId string) (*JobRecord, error) {
+	buf, err := os.ReadFile(jm.getRecordPath(driveId))
+
+	if err != nil {
+		return nil, err
+	}
+
+	record := &JobRecord{}
+
+	if err := json.Unmarshal(buf, record); err != nil {
+		jm.logger.Errorf("failed to parse job record. %v", err)
+		return nil, err
+	}
+
+	if record.Options == nil {
+		record.Options = &JobOptions{}
+	}
+
+	return record, nil
+}
+
+func (jm *JobManager) getRecordsDirectoryPath() string {
+	return filepath.Join(jm.conf.Paths.State, recordsFolderName)
+}
+
+func (jm *JobManager) getRecordPath(driveId string) string {
+	return filepath.Join(jm.getRecordsDirectoryPath(), filepath.Base(driveId)+".json")
+}
+
+// keepExtractionState copies the extraction state of archives which did not
+// change since the previous job, since they were not extracted again.
+func keepExtractionState(previous []*ManifestEntry, manifest []*ManifestEntry) {
+	previousEntries := make(map[string]*ManifestEntry)
+
+	for _, entry := range previous {
+		previousEntries[entry.Id] = entry
+	}
+
+	for _, entry := range manifest {
+		previousEntry, ok := previousEntries[entry.Id]
+
+		if !ok || len(entry.ExtractedFiles) > 0 || entry.Removed || previousEntry.Path != entry.Path ||
+			previousEntry.Md5Checksum != entry.Md5Checksum {
+			continue
+		}
+
+		entry.ExtractedFiles = previousEntry.ExtractedFiles
+		entry.Removed = previousEntry.Removed
+	}
+}
+
+// mergeManifests replaces the entries of the manifest with the updated ones
+// and appends the entries of new files.
+func mergeManifests(manifest []*ManifestEntry, updates []*ManifestEntry) []*ManifestEntry {
+	merged := make([]*ManifestEntry, 0, len(manifest)+len(updates))
+	updated := make(map[string]bool)
+
+	for _, entry := range updates {
+		updated[entry.Id] = true
+	}
+
+	for _, entry := range manifest {
+		if !updated[entry.Id] {
+			merged = append(merged, entry)
+		}
+	}
+
+	return append(merged, updates...)
+}
@@ -0,0 +1,153 @@
+package download
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	ChecksumManifestMd5  = "md5"
+	ChecksumManifestSfv  = "sfv"
+	ChecksumManifestJson = "json"
+)
+
+type checksumManifestEntry struct {
+	Path        string
+	Size        int64
+	Id          string
+	Md5Checksum string
+}
+
+// writeChecksumManifest writes the checksums of all files of the job into a
+// sidecar file in its target directory, so the files can be verified without
+// gogdl-ng. Files which failed to download are left out.
+func (jm *JobManager) writeChecksumManifest(record *JobRecord) error {
+	format := jm.conf.Download.ChecksumManifest
+
+	if len(format) == 0 {
+		return nil
+	}
+
+	targetDirectoryPath := record.Path
+	entries := []*checksumManifestEntry{}
+
+	for _, manifestEntry := range record.Manifest {
+		stat, err := os.Stat(filepath.Join(targetDirectoryPath, filepath.FromSlash(manifestEntry.Path)))
+
+		if err != nil || stat.Size() != manifestEntry.Size {
+			continue
+		}
+
+		entries = append(entries, &checksumManifestEntry{
+			Path:        manifestEntry.Path,
+			Size:        manifestEntry.Size,
+			Id:          manifestEntry.Id,
+			Md5Checksum: manifestEntry.Md5Checksum,
+		})
+	}
+
+	path := getChecksumManifestPath(targetDirectoryPath, format)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+
+	switch format {
+	case ChecksumManifestMd5:
+		err = writeMd5Manifest(w, entries)
+	case ChecksumManifestSfv:
+		err = writeSfvManifest(w, targetDirectoryPath, entries)
+	case ChecksumManifestJson:
+		err = writeJsonManifest(w, entries)
+	default:
+		err = fmt.Errorf("unknown checksum manifest format '%s'", format)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// getChecksumManifestPath returns the path of the sidecar file. It is named
+// after the target directory.
+func getChecksumManifestPath(targetDirectoryPath string, format string) string {
+	return filepath.Join(targetDirectoryPath, filepath.Base(targetDirectoryPath)+"."+format)
+}
+
+// writeMd5Manifest writes a file which can be checked with md5sum -c. Files
+// without an md5 checksum are left out, since md5sum rejects the whole file
+// because of a line without one.
+func writeMd5Manifest(w io.Writer, entries []*checksumManifestEntry) error {
+	for _, entry := range entries {
+		if len(entry.Md5Checksum) == 0 {
+			continue
+		}
+
+		if _, err := fmt.Fprintf(w, "%s  %s\n", entry.Md5Checksum, entry.Path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeSfvManifest(w io.Writer, targetDirectoryPath string, entries []*checksumManifestEntry) error {
+	if _, err := fmt.Fprintln(w, "; generated by gogdl-ng"); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		checksum, err := getCrc32Checksum(filepath.Join(targetDirectoryPath, filepath.FromSlash(entry.Path)))
+
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(w, "%s %08X\n", entry.Path, checksum); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeJsonManifest(w io.Writer, entries []*checksumManifestEntry) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(entries)
+}
+
+func getCrc32Checksum(path string) (uint32, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer file.Close()
+
+	hash := crc32.NewIEEE()
+
+	if _, err := io.Copy(hash, file); err != nil {
+		return 0, err
+	}
+
+	return hash.Sum32(), nil
+}
@@ -0,0 +1,89 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gogdl-ng/gogdl-ng/app/disk"
+	"github.com/gogdl-ng/gogdl-ng/app/gdrive"
+)
+
+// ErrNotEnoughDiskSpace is returned when the files of a job do not fit on the
+// volume. The job is deferred until enough space is free.
+var ErrNotEnoughDiskSpace = errors.New("not enough disk space")
+
+// checkDiskSpace verifies that the remaining files of the job fit on the
+// incomplete volume and that the whole job fits on the volume of its target
+// directory.
+func (jm *JobManager) checkDiskSpace(job *Job, files []*gdrive.DriveFile) error {
+	reserve := jm.conf.Download.ReservedDiskSpace * disk.Megabyte
+
+	if reserve == 0 {
+		return nil
+	}
+
+	var totalSize, remainingSize uint64
+
+	for _, driveFile := range files {
+		size := uint64(driveFile.Remote.Size)
+		totalSize += size
+		remainingSize += size
+
+		if stat, err := os.Stat(driveFile.Path); err == nil && uint64(stat.Size()) <= size {
+			remainingSize -= uint64(stat.Size())
+		} else if stat, err := os.Stat(driveFile.PartPath()); err == nil && uint64(stat.Size()) <= size {
+			remainingSize -= uint64(stat.Size())
+		}
+	}
+
+	if err := checkFreeSpace(jm.IncompleteDirectoryPath, remainingSize+reserve); err != nil {
+		return err
+	}
+
+	targetDirectoryPath := getExistingDirectoryPath(jm.getTargetDirectoryPath(job))
+	sameVolume, err := disk.SameVolume(jm.IncompleteDirectoryPath, targetDirectoryPath)
+
+	if err != nil {
+		return err
+	}
+
+	if sameVolume {
+		return nil
+	}
+
+	return checkFreeSpace(targetDirectoryPath, totalSize+reserve)
+}
+
+// getExistingDirectoryPath returns the path itself or its nearest parent which
+// already exists.
+func getExistingDirectoryPath(path string) string {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+
+		parent := filepath.Dir(path)
+
+		if parent == path {
+			return path
+		}
+
+		path = parent
+	}
+}
+
+func checkFreeSpace(path string, requiredSpace uint64) error {
+	freeSpace, err := disk.FreeSpace(path)
+
+	if err != nil {
+		return err
+	}
+
+	if freeSpace < requiredSpace {
+		return fmt.Errorf("%w in '%s' (required: %d bytes, free: %d bytes)", ErrNotEnoughDiskSpace, path, requiredSpace, freeSpace)
+	}
+
+	return nil
+}
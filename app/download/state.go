@@ -1,8 +1,10 @@
 package download
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 func (jm *JobManager) createDriveIdFile(path string, driveId string) error {
@@ -30,3 +32,80 @@ func (jm *JobManager) readDriveIdFile(path string) (string, error) {
 
 	return driveId, nil
 }
+
+// jobState is the content of the job file.
+type jobState struct {
+	Status         JobStatus
+	Options        *JobOptions
+	Manifest       []*ManifestEntry `json:",omitempty"`
+	FailedFiles    []string         `json:",omitempty"`
+	FailedArchives []string         `json:",omitempty"`
+	DeferredUntil  time.Time
+	CopiedFiles    []string        `json:",omitempty"`
+	TargetPath     string          `json:",omitempty"`
+	History        []*HistoryEntry `json:",omitempty"`
+}
+
+func (jm *JobManager) writeJobFile(job *Job) error {
+	path := filepath.Join(job.Path, jobFileName)
+
+	state := &jobState{
+		Status:         job.Status,
+		Options:        job.Options,
+		Manifest:       job.Manifest,
+		FailedFiles:    job.FailedFiles,
+		FailedArchives: job.FailedArchives,
+		DeferredUntil:  job.DeferredUntil,
+		CopiedFiles:    job.CopiedFiles,
+		TargetPath:     job.TargetPath,
+		History:        job.History,
+	}
+
+	buf, err := json.MarshalIndent(state, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	// the archive passwords of the job are only readable by the owner.
+	var mode os.FileMode = 0644
+
+	if len(job.Options.Passwords) > 0 {
+		mode = 0600
+	}
+
+	if err := os.WriteFile(path, buf, mode); err != nil {
+		jm.logger.Errorf("failed to write job file. %v", err)
+		return err
+	}
+
+	// the mode of an existing file is not changed by WriteFile.
+	return os.Chmod(path, mode)
+}
+
+func (jm *JobManager) readJobFile(path string) (*jobState, error) {
+	path = filepath.Join(path, jobFileName)
+	state := &jobState{Options: &JobOptions{}}
+
+	buf, err := os.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+
+	if err != nil {
+		jm.logger.Errorf("failed to read job file. %v", err)
+		return nil, err
+	}
+
+	if err := json.Unmarshal(buf, state); err != nil {
+		jm.logger.Errorf("failed to parse job file. %v", err)
+		return nil, err
+	}
+
+	if state.Options == nil {
+		state.Options = &JobOptions{}
+	}
+
+	return state, nil
+}
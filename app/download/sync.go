@@ -0,0 +1,122 @@
+package download
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/gogdl-ng/gogdl-ng/app/gdrive"
+)
+
+func (options *JobOptions) isSync() bool {
+	return options.Mode == JobModeSync || options.Mode == JobModeMirror
+}
+
+// setSyncDestination lets a sync job download into the target directory of
+// the last job of the folder, unless the job has its own destination.
+func (jm *JobManager) setSyncDestination(driveId string, options *JobOptions) error {
+	if !options.isSync() || len(options.Destination) > 0 || len(options.Category) > 0 {
+		return nil
+	}
+
+	record, err := jm.ReadJobRecord(driveId)
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	options.Destination = record.Path
+
+	return nil
+}
+
+// getChangedFiles returns the files which were added or changed since the last
+// job of the folder. All files are returned when there is no such job.
+func (jm *JobManager) getChangedFiles(job *Job, files []*gdrive.DriveFile) ([]*gdrive.DriveFile, error) {
+	record, err := jm.ReadJobRecord(job.Id)
+
+	if os.IsNotExist(err) {
+		return files, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if record.Path != jm.getTargetDirectoryPath(job) {
+		return files, nil
+	}
+
+	knownFiles := make(map[string]*ManifestEntry)
+
+	for _, entry := range record.Manifest {
+		knownFiles[entry.Id] = entry
+	}
+
+	var changedFiles []*gdrive.DriveFile
+
+	for _, driveFile := range files {
+		entry, ok := knownFiles[driveFile.Remote.Id]
+
+		if ok && entry.Md5Checksum == driveFile.Remote.Md5Checksum && entry.ModifiedTime == driveFile.Remote.ModifiedTime &&
+			entry.Path == filepath.ToSlash(driveFile.Path) {
+			continue
+		}
+
+		changedFiles = append(changedFiles, driveFile)
+	}
+
+	jm.logger.Infof("%d of %d file(s) of folder '%s' were added or changed since the last job", len(changedFiles), len(files), job.Id)
+
+	return changedFiles, nil
+}
+
+// removeDeletedFiles deletes the local files of the last job which are no
+// longer part of the folder. Folders which become empty are deleted as well.
+func (jm *JobManager) removeDeletedFiles(record *JobRecord, manifest []*ManifestEntry) error {
+	currentPaths := make(map[string]bool)
+
+	for _, entry := range manifest {
+		currentPaths[entry.Path] = true
+	}
+
+	for _, entry := range record.Manifest {
+		if currentPaths[entry.Path] {
+			continue
+		}
+
+		// files which were extracted from the archive are removed along with it.
+		for _, relativePath := range append([]string{entry.Path}, entry.ExtractedFiles...) {
+			path := filepath.Join(record.Path, filepath.FromSlash(relativePath))
+
+			if err := gdrive.EnsureContained(record.Path, path); err != nil {
+				return err
+			}
+
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+
+			jm.logger.Infof("removed '%s' because it was deleted from the folder", path)
+
+			removeEmptyParents(record.Path, filepath.Dir(path))
+		}
+	}
+
+	return nil
+}
+
+// removeEmptyParents deletes the folder and its parents up to the root as long
+// as they are empty.
+func removeEmptyParents(root string, path string) {
+	for path != root && gdrive.EnsureContained(root, path) == nil {
+		if err := os.Remove(path); err != nil {
+			return
+		}
+
+		path = filepath.Dir(path)
+	}
+}
@@ -0,0 +1,196 @@
+package download
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/gogdl-ng/gogdl-ng/app/gdrive"
+)
+
+// VerifyReport lists the differences between a Google Drive folder and the
+// target directory of its last finished job. Paths are relative to the target
+// directory.
+type VerifyReport struct {
+	DriveId          string
+	Path             string
+	Missing          []string
+	Extra            []string
+	SizeMismatch     []string
+	ChecksumMismatch []string
+	Requeued         int
+}
+
+// VerifyJob compares the files of the folder with the files in the target
+// directory of its last finished job. When requeue is set a job which only
+// downloads the missing and mismatching files is created.
+func (jm *JobManager) VerifyJob(driveId string, requeue bool) (*VerifyReport, error) {
+	record, err := jm.ReadJobRecord(driveId)
+
+	if err != nil {
+		return nil, fmt.Errorf("no finished job found for folder '%s'. %w", driveId, err)
+	}
+
+	folder, err := jm.drive.GetFolder(driveId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := jm.drive.GetFiles(folder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	files, _, err = jm.selectFiles(record.Options, files)
+
+	if err != nil {
+		return nil, err
+	}
+
+	report := &VerifyReport{
+		DriveId:          driveId,
+		Path:             record.Path,
+		Missing:          []string{},
+		Extra:            []string{},
+		SizeMismatch:     []string{},
+		ChecksumMismatch: []string{},
+	}
+
+	expectedPaths := make(map[string]bool)
+	entries := make(map[string]*ManifestEntry)
+	var invalidFileIds []string
+
+	for _, entry := range record.Manifest {
+		entries[entry.Path] = entry
+	}
+
+	for _, driveFile := range files {
+		if driveFile.IsGoogleDocument() {
+			continue
+		}
+
+		relativePath := filepath.ToSlash(driveFile.Path)
+		expectedPaths[relativePath] = true
+
+		if entry, ok := entries[relativePath]; ok && entry.Md5Checksum == driveFile.Remote.Md5Checksum {
+			for _, extractedFile := range entry.ExtractedFiles {
+				expectedPaths[extractedFile] = true
+			}
+
+			// archives which were deleted after the extraction can not be verified.
+			if entry.Removed {
+				continue
+			}
+		}
+
+		valid, err := jm.verifyFile(report, record.Path, relativePath, driveFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !valid {
+			invalidFileIds = append(invalidFileIds, driveFile.Remote.Id)
+		}
+	}
+
+	if err := jm.findExtraFiles(report, record.Path, expectedPaths); err != nil {
+		return nil, err
+	}
+
+	jm.logger.Infof("verified folder '%s' (missing: %d, extra: %d, size mismatch: %d, checksum mismatch: %d)",
+		driveId, len(report.Missing), len(report.Extra), len(report.SizeMismatch), len(report.ChecksumMismatch))
+
+	if !requeue || len(invalidFileIds) == 0 {
+		return report, nil
+	}
+
+	options := &JobOptions{
+		Filter:      record.Options.Filter,
+		Destination: record.Path,
+		FileIds:     invalidFileIds,
+	}
+
+	if err := jm.CreateJob(driveId, options); err != nil {
+		return nil, err
+	}
+
+	report.Requeued = len(invalidFileIds)
+
+	return report, nil
+}
+
+func (jm *JobManager) verifyFile(report *VerifyReport, targetDirectoryPath string, relativePath string, driveFile *gdrive.DriveFile) (bool, error) {
+	path := filepath.Join(targetDirectoryPath, filepath.FromSlash(relativePath))
+	stat, err := os.Stat(path)
+
+	if os.IsNotExist(err) {
+		report.Missing = append(report.Missing, relativePath)
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if stat.Size() != driveFile.Remote.Size {
+		report.SizeMismatch = append(report.SizeMismatch, relativePath)
+		return false, nil
+	}
+
+	algorithm, expectedChecksum := jm.drive.GetVerifyAlgorithm(driveFile.Remote)
+
+	// only the size of files without checksum can be verified.
+	if len(expectedChecksum) == 0 {
+		return true, nil
+	}
+	checksum, err := gdrive.GetChecksum(path, algorithm)
+
+	if err != nil {
+		return false, err
+	}
+
+	if checksum != expectedChecksum {
+		report.ChecksumMismatch = append(report.ChecksumMismatch, relativePath)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// findExtraFiles adds all files of the target directory which do not belong to
+// the folder to the report. Checksum manifests written by gogdl-ng are ignored.
+func (jm *JobManager) findExtraFiles(report *VerifyReport, targetDirectoryPath string, expectedPaths map[string]bool) error {
+	checksumManifestPaths := map[string]bool{
+		getChecksumManifestPath(targetDirectoryPath, ChecksumManifestMd5):  true,
+		getChecksumManifestPath(targetDirectoryPath, ChecksumManifestSfv):  true,
+		getChecksumManifestPath(targetDirectoryPath, ChecksumManifestJson): true,
+	}
+
+	return filepath.WalkDir(targetDirectoryPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() || checksumManifestPaths[path] {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(targetDirectoryPath, path)
+
+		if err != nil {
+			return err
+		}
+
+		relativePath = filepath.ToSlash(relativePath)
+
+		if !expectedPaths[relativePath] {
+			report.Extra = append(report.Extra, relativePath)
+		}
+
+		return nil
+	})
+}
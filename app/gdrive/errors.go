@@ -0,0 +1,175 @@
+package gdrive
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/avast/retry-go"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+type ErrorClass string
+
+const (
+	// ErrorClassPermanent errors fail the same way when they are retried.
+	ErrorClassPermanent ErrorClass = "permanent"
+
+	// ErrorClassRateLimit errors are retried with a longer backoff.
+	ErrorClassRateLimit ErrorClass = "rateLimit"
+
+	// ErrorClassTransient errors are retried with the default backoff.
+	ErrorClassTransient ErrorClass = "transient"
+
+	rateLimitDelay    = time.Second
+	maxRateLimitDelay = 64 * time.Second
+
+	reasonAbusiveFile = "cannotDownloadAbusiveFile"
+)
+
+var ErrChecksumMismatch = errors.New("checksum of local file != checksum of remote file. file is probably corrupted")
+
+// ErrCancelled is returned when the job of a file was cancelled while its
+// download waited for free disk space.
+var ErrCancelled = errors.New("download was cancelled")
+
+var (
+	permanentReasons = map[string]bool{
+		"notFound":                    true,
+		reasonAbusiveFile:             true,
+		"insufficientFilePermissions": true,
+		"fileNotDownloadable":         true,
+		"cannotDownloadFile":          true,
+		"downloadQuotaExceeded":       true,
+	}
+
+	rateLimitReasons = map[string]bool{
+		"rateLimitExceeded":        true,
+		"userRateLimitExceeded":    true,
+		"sharingRateLimitExceeded": true,
+	}
+)
+
+// DriveError is an error with the reason Google Drive gave for it and whether
+// it is worth to retry the request.
+type DriveError struct {
+	Class  ErrorClass
+	Reason string
+
+	// RetryAfter is the delay the server asked for before the next request.
+	RetryAfter time.Duration
+
+	Err error
+}
+
+func (e *DriveError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DriveError) Unwrap() error {
+	return e.Err
+}
+
+// ClassifyError determines the reason and class of the error.
+func ClassifyError(err error) *DriveError {
+	var driveError *DriveError
+
+	if errors.As(err, &driveError) {
+		return driveError
+	}
+
+	driveError = &DriveError{Class: ErrorClassTransient, Reason: "unknown", Err: err}
+
+	var retrieveError *oauth2.RetrieveError
+	var apiError *googleapi.Error
+
+	switch {
+	case errors.Is(err, ErrChecksumMismatch):
+		driveError.Class = ErrorClassPermanent
+		driveError.Reason = "checksumMismatch"
+	case errors.Is(err, ErrCancelled):
+		driveError.Class = ErrorClassPermanent
+		driveError.Reason = "cancelled"
+	case errors.As(err, &retrieveError):
+		driveError.Class = ErrorClassPermanent
+		driveError.Reason = "authExpired"
+	case errors.As(err, &apiError):
+		classifyApiError(driveError, apiError)
+	}
+
+	return driveError
+}
+
+func classifyApiError(driveError *DriveError, apiError *googleapi.Error) {
+	driveError.Reason = http.StatusText(apiError.Code)
+
+	if len(apiError.Errors) > 0 {
+		driveError.Reason = apiError.Errors[0].Reason
+	}
+
+	switch {
+	case rateLimitReasons[driveError.Reason] || apiError.Code == http.StatusTooManyRequests:
+		driveError.Class = ErrorClassRateLimit
+		driveError.RetryAfter = parseRetryAfter(apiError.Header.Get("Retry-After"))
+	case permanentReasons[driveError.Reason]:
+		driveError.Class = ErrorClassPermanent
+	case apiError.Code >= 400 && apiError.Code < 500 && apiError.Code != http.StatusRequestTimeout:
+		driveError.Class = ErrorClassPermanent
+	}
+}
+
+// isInaccessibleError reports whether the item does not exist or the account
+// has no access to it.
+func isInaccessibleError(err error) bool {
+	var apiError *googleapi.Error
+
+	if !errors.As(err, &apiError) {
+		return false
+	}
+
+	return apiError.Code == http.StatusNotFound || apiError.Code == http.StatusForbidden && !rateLimitReasons[ClassifyError(err).Reason]
+}
+
+// parseRetryAfter parses the value of a Retry-After header which is either a
+// number of seconds or a date.
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+
+	return 0
+}
+
+func isRetryable(err error) bool {
+	return ClassifyError(err).Class != ErrorClassPermanent
+}
+
+// getRetryDelay honours the Retry-After header of rate limited requests and
+// otherwise backs off exponentially with jitter. Rate limited requests start
+// with a longer delay.
+func getRetryDelay(n uint, err error, config *retry.Config) time.Duration {
+	driveError := ClassifyError(err)
+
+	if driveError.Class != ErrorClassRateLimit {
+		return retry.CombineDelay(retry.BackOffDelay, retry.RandomDelay)(n, err, config)
+	}
+
+	if driveError.RetryAfter > 0 {
+		return driveError.RetryAfter
+	}
+
+	delay := maxRateLimitDelay
+
+	if n < 6 {
+		delay = rateLimitDelay << n
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)))
+}
@@ -1,28 +1,120 @@
 package gdrive
 
 import (
-	"crypto/md5"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/avast/retry-go"
 	"google.golang.org/api/drive/v3"
 )
 
+const (
+	mimeTypeGoogleAppsPrefix = "application/vnd.google-apps."
+
+	// PartFileSuffix is appended to the name of a file while it is downloaded.
+	// The file is renamed to its final name once its checksum was verified.
+	PartFileSuffix = ".part"
+)
+
 type DriveFile struct {
 	Remote     *drive.File
 	Descriptor *os.File
 	Path       string
 	Size       int64
+
+	// RemotePath is the path of the file in the folder made of the original
+	// names of the Google Drive items.
+	RemotePath string
+
+	// Parent is the folder which contains the file. It is nil for files in the
+	// folder of the job itself.
+	Parent *DriveFolder
+
+	// FolderId is the id of the Google Drive folder the file was listed in.
+	FolderId string
+
+	// PreviousRemote is the metadata the file was listed with. It is set when
+	// the file was replaced in Google Drive while the job was running.
+	PreviousRemote *drive.File
+
+	// VerifiedWith is the algorithm whose checksum was verified after the
+	// file was downloaded. A completed file without it, e.g. one of an older
+	// version, is verified before it is skipped.
+	VerifiedWith string
+
+	// AcknowledgeAbuse allows to download the file when Google Drive flagged
+	// it as malware or spam. AbuseAcknowledged is set once it was flagged.
+	AcknowledgeAbuse  bool
+	AbuseAcknowledged bool
+
+	// Cancelled reports whether the job of the file was cancelled. It stops a
+	// download which waits for free disk space.
+	Cancelled func() bool
+}
+
+// IsGoogleDocument reports whether the file is a Google Docs, Sheets, Slides
+// etc. document. Those have no binary content and can only be exported.
+func (driveFile *DriveFile) IsGoogleDocument() bool {
+	return strings.HasPrefix(driveFile.Remote.MimeType, mimeTypeGoogleAppsPrefix)
 }
 
+// PartPath returns the path the file is written to while it is downloaded.
+func (driveFile *DriveFile) PartPath() string {
+	return driveFile.Path + PartFileSuffix
+}
+
+// DownloadFile downloads the file into its part file and renames it once its
+// checksum was verified. When the file can not be found or its checksum does
+// not match, it is downloaded again with its current metadata in case it was
+// replaced after the folder was listed.
 func (ds *DriveService) DownloadFile(driveFile *DriveFile) error {
-	return retry.Do(func() error {
-		ds.logger.Infof("file: %s", driveFile.Remote.Name)
+	err := ds.downloadFile(driveFile)
+
+	if err == nil || !isStaleMetadataError(err) || driveFile.PreviousRemote != nil {
+		return err
+	}
+
+	changed, refreshErr := ds.refreshMetadata(driveFile)
+
+	if refreshErr != nil {
+		ds.logger.Errorf("failed to refresh metadata of file. %v", refreshErr)
+		return err
+	}
+
+	if !changed {
+		return err
+	}
+
+	if err := removePartFile(driveFile); err != nil {
+		ds.logger.Errorf("failed to remove part file. %v", err)
+		return err
+	}
+
+	return ds.downloadFile(driveFile)
+}
+
+func (ds *DriveService) downloadFile(driveFile *DriveFile) error {
+	ds.logger.Infof("file: %s", driveFile.Remote.Name)
+
+	completed, err := ds.checkWhetherFileIsCompleted(driveFile)
 
+	if err != nil {
+		ds.logger.Errorf("failed to check whether file is completed. %v", err)
+		return err
+	}
+
+	if completed {
+		return nil
+	}
+
+	err = retry.Do(func() error {
 		if err := ds.getFileMetadata(driveFile); err != nil {
 			ds.logger.Errorf("failed to get file metadata. %v", err)
 			return err
@@ -30,70 +122,186 @@ func (ds *DriveService) DownloadFile(driveFile *DriveFile) error {
 
 		defer driveFile.Descriptor.Close()
 
-		if driveFile.Size > 0 {
-			if ds.checkWhetherFileIsCompleted(driveFile) {
-				return nil
-			}
-
-			if ds.checkWhetherFileIsCorrupted(driveFile) {
-				if err := truncate(driveFile.Descriptor); err != nil {
-					ds.logger.Errorf("failed to truncate file. %v", err)
-					return err
-				}
+		if ds.checkWhetherFileIsCorrupted(driveFile) {
+			if err := truncate(driveFile); err != nil {
+				ds.logger.Errorf("failed to truncate file. %v", err)
+				return err
 			}
 		}
 
-		content, err := ds.requestFileContent(driveFile)
+		algorithm, expectedChecksum := ds.GetVerifyAlgorithm(driveFile.Remote)
+
+		// the hash is calculated while the content is written. the content of
+		// an earlier attempt is covered by the saved hash state.
+		hash, err := ds.restoreHash(driveFile, algorithm)
 
 		if err != nil {
-			ds.logger.Errorf("failed to fetch content of file. %v", err)
+			ds.logger.Errorf("failed to calculate %s checksum. %v", algorithm, err)
 			return err
 		}
 
-		w, err := io.Copy(driveFile.Descriptor, *content)
-		driveFile.Size = w
-
-		if err != nil {
-			ds.logger.Errorf("Failed to write fetched content to file. %v", err)
-			return err
+		if driveFile.Size < driveFile.Remote.Size {
+			if err := ds.writeFileContent(driveFile, algorithm, hash); err != nil {
+				return err
+			}
 		}
 
-		md5Checksum, err := getMd5Checksum(driveFile)
+		if len(expectedChecksum) == 0 {
+			ds.logger.Warnf("Google Drive provides no checksum for file '%s'. verifying its size only.", driveFile.Remote.Name)
+			algorithm = VerifyAlgorithmSize
 
-		if err != nil {
-			ds.logger.Errorf("failed to calculate md5 checksum. %v", err)
-			return err
+			if driveFile.Size != driveFile.Remote.Size {
+				return fmt.Errorf("size of local file (%d) != size of remote file (%d)", driveFile.Size, driveFile.Remote.Size)
+			}
+		} else if fmt.Sprintf("%x", hash.Sum(nil)) != expectedChecksum {
+			ds.logger.Error(ErrChecksumMismatch)
+
+			if err := truncate(driveFile); err != nil {
+				ds.logger.Errorf("failed to truncate file. %v", err)
+			}
+
+			return ErrChecksumMismatch
 		}
 
-		if md5Checksum != driveFile.Remote.Md5Checksum {
-			err := errors.New("checksum of local file != checksum of remote file. file is probably corrupted")
-			ds.logger.Error(err)
+		if err := completeFile(driveFile); err != nil {
+			ds.logger.Errorf("failed to rename part file. %v", err)
 			return err
 		}
 
-		ds.logger.Info("finished downloading file")
+		// the file is complete at this point, so it is not downloaded again
+		// because of a file system which does not support modification times.
+		if err := SetModifiedTime(driveFile.Path, driveFile.Remote); err != nil {
+			ds.logger.Warnf("failed to set modification time of file. %v", err)
+		}
+
+		driveFile.VerifiedWith = algorithm
+		ds.logger.Infof("finished downloading file (verified: %s)", algorithm)
 
 		return nil
-	}, retry.Attempts(ds.conf.Download.RetryThreeshold))
+	},
+		retry.Attempts(ds.conf.Download.RetryThreeshold),
+		retry.LastErrorOnly(true),
+		retry.RetryIf(isRetryable),
+		retry.DelayType(getRetryDelay),
+		retry.OnRetry(func(n uint, err error) {
+			driveError := ClassifyError(err)
+			ds.logger.Warnf("attempt %d to download file '%s' failed (reason: %s, class: %s)", n+1, driveFile.Remote.Name, driveError.Reason, driveError.Class)
+		}))
+
+	if err != nil {
+		return ClassifyError(err)
+	}
+
+	return nil
 }
 
-func (ds *DriveService) checkWhetherFileIsCompleted(driveFile *DriveFile) bool {
-	if driveFile.Size == driveFile.Remote.Size {
-		md5Checksum, err := getMd5Checksum(driveFile)
+func (ds *DriveService) writeFileContent(driveFile *DriveFile, algorithm string, hash hash.Hash) error {
+	directory := filepath.Dir(driveFile.Path)
+
+	if err := ds.waitForDiskSpace(driveFile, directory); err != nil {
+		return err
+	}
+
+	content, err := ds.requestFileContent(driveFile)
+
+	if err != nil {
+		ds.logger.Errorf("failed to fetch content of file. %v", err)
+		return err
+	}
+
+	defer (*content).Close()
+
+	stateWriter := ds.newHashStateWriter(driveFile, algorithm, hash)
+
+	w, err := io.Copy(io.MultiWriter(ds.newReserveWriter(driveFile, directory), hash, stateWriter), *content)
+	driveFile.Size += w
+
+	if err != nil {
+		stateWriter.save()
+		ds.logger.Errorf("Failed to write fetched content to file. %v", err)
+
+		if errors.Is(err, syscall.ENOSPC) {
+			ds.waitForDiskSpace(driveFile, directory)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// checkWhetherFileIsCompleted reports whether the file was already downloaded.
+// A file only gets its final name after its checksum was verified. A leftover
+// part file next to a completed file is removed. A completed file which is not
+// known to be verified is verified once and removed when its checksum does not
+// match.
+func (ds *DriveService) checkWhetherFileIsCompleted(driveFile *DriveFile) (bool, error) {
+	stat, err := os.Stat(driveFile.Path)
+
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if stat.Size() != driveFile.Remote.Size {
+		// files of older versions were written without the part suffix.
+		ds.logger.Warnf("size of local file != size of remote file. resuming it as part file.")
+		return false, os.Rename(driveFile.Path, driveFile.PartPath())
+	}
+
+	if err := os.Remove(driveFile.PartPath()); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	if err := removeHashState(driveFile); err != nil {
+		return false, err
+	}
+
+	if len(driveFile.VerifiedWith) == 0 {
+		verified, err := ds.verifyCompletedFile(driveFile)
 
 		if err != nil {
-			ds.logger.Errorf("failed to calculate md5 checksum. %v", err)
-			return false
+			return false, err
 		}
 
-		if md5Checksum != driveFile.Remote.Md5Checksum {
-			return false
+		if !verified {
+			ds.logger.Warnf("checksum of completed file '%s' does not match. downloading it again.", driveFile.Remote.Name)
+			return false, os.Remove(driveFile.Path)
 		}
 	}
 
 	ds.logger.Info("file is already completed")
 
-	return true
+	return true, nil
+}
+
+// verifyCompletedFile compares the checksum of the completed file with the one
+// of Google Drive.
+func (ds *DriveService) verifyCompletedFile(driveFile *DriveFile) (bool, error) {
+	algorithm, expectedChecksum := ds.GetVerifyAlgorithm(driveFile.Remote)
+
+	// the size was already compared.
+	if len(expectedChecksum) == 0 {
+		driveFile.VerifiedWith = VerifyAlgorithmSize
+		return true, nil
+	}
+
+	checksum, err := GetChecksum(driveFile.Path, algorithm)
+
+	if err != nil {
+		return false, err
+	}
+
+	if checksum != expectedChecksum {
+		return false, nil
+	}
+
+	driveFile.VerifiedWith = algorithm
+
+	return true, nil
 }
 
 func (ds *DriveService) checkWhetherFileIsCorrupted(driveFile *DriveFile) bool {
@@ -108,13 +316,22 @@ func (ds *DriveService) checkWhetherFileIsCorrupted(driveFile *DriveFile) bool {
 func (ds *DriveService) requestFileContent(driveFile *DriveFile) (*io.ReadCloser, error) {
 	request := ds.drive.Files.Get(driveFile.Remote.Id).
 		SupportsAllDrives(true).
-		SupportsTeamDrives(true)
+		SupportsTeamDrives(true).
+		AcknowledgeAbuse(driveFile.AbuseAcknowledged)
 
 	request.Header().Add("Range", fmt.Sprintf("bytes=%d-", driveFile.Size))
 
 	response, err := request.Download()
 
+	if err != nil && driveFile.AcknowledgeAbuse && !driveFile.AbuseAcknowledged && ClassifyError(err).Reason == reasonAbusiveFile {
+		ds.logger.Warnf("file '%s' (id: %s) was flagged as malware or spam by Google Drive. downloading it anyway.", driveFile.Remote.Name, driveFile.Remote.Id)
+		driveFile.AbuseAcknowledged = true
+
+		return ds.requestFileContent(driveFile)
+	}
+
 	if err != nil {
+		ds.checkAuthError(err)
 		return nil, err
 	}
 
@@ -138,7 +355,7 @@ func getFileDescriptor(driveFile *DriveFile) error {
 		return err
 	}
 
-	descriptor, err := os.OpenFile(driveFile.Path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	descriptor, err := os.OpenFile(driveFile.PartPath(), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
 
 	if err != nil {
 		return err
@@ -161,34 +378,47 @@ func getFileSize(driveFile *DriveFile) error {
 	return nil
 }
 
-func getMd5Checksum(driveFile *DriveFile) (string, error) {
-	hash := md5.New()
-
-	_, err := driveFile.Descriptor.Seek(0, io.SeekStart)
+// completeFile closes the part file and renames it to its final name.
+func completeFile(driveFile *DriveFile) error {
+	if err := driveFile.Descriptor.Close(); err != nil {
+		return err
+	}
 
-	if err != nil {
-		return "", err
+	if err := removeHashState(driveFile); err != nil {
+		return err
 	}
 
-	if _, err := io.Copy(hash, driveFile.Descriptor); err != nil {
-		return "", err
+	return os.Rename(driveFile.PartPath(), driveFile.Path)
+}
+
+// SetModifiedTime sets the modification time of the local file or folder to
+// the one of the Google Drive item.
+func SetModifiedTime(path string, remote *drive.File) error {
+	if len(remote.ModifiedTime) == 0 {
+		return nil
 	}
 
-	md5Checksum := fmt.Sprintf("%x", hash.Sum(nil))
+	modifiedTime, err := time.Parse(time.RFC3339, remote.ModifiedTime)
 
-	return md5Checksum, nil
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(path, time.Now(), modifiedTime)
 }
 
-func truncate(file *os.File) error {
-	if err := file.Truncate(0); err != nil {
+func truncate(driveFile *DriveFile) error {
+	if err := driveFile.Descriptor.Truncate(0); err != nil {
 		return err
 	}
 
-	_, err := file.Seek(0, io.SeekStart)
+	_, err := driveFile.Descriptor.Seek(0, io.SeekStart)
 
 	if err != nil {
 		return err
 	}
 
-	return nil
+	driveFile.Size = 0
+
+	return removeHashState(driveFile)
 }
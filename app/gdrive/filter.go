@@ -0,0 +1,208 @@
+package gdrive
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gogdl-ng/gogdl-ng/app/config"
+)
+
+const regexPatternPrefix = "re:"
+
+// Filter decides which of the listed files of a folder are downloaded.
+type Filter config.FilterConfiguration
+
+type patternMatcher func(filePath string) bool
+
+// WithDefaults returns a copy of the filter where every unset property is
+// taken from the given defaults.
+func (f *Filter) WithDefaults(defaults config.FilterConfiguration) *Filter {
+	filter := Filter(defaults)
+
+	if f == nil {
+		return &filter
+	}
+
+	if len(f.Include) > 0 {
+		filter.Include = f.Include
+	}
+
+	if len(f.Exclude) > 0 {
+		filter.Exclude = f.Exclude
+	}
+
+	if f.MinSize > 0 {
+		filter.MinSize = f.MinSize
+	}
+
+	if f.MaxSize > 0 {
+		filter.MaxSize = f.MaxSize
+	}
+
+	if len(f.MimeTypes) > 0 {
+		filter.MimeTypes = f.MimeTypes
+	}
+
+	if f.MaxDepth > 0 {
+		filter.MaxDepth = f.MaxDepth
+	}
+
+	return &filter
+}
+
+// Validate checks whether all patterns of the filter can be compiled.
+func (f *Filter) Validate() error {
+	if f == nil {
+		return nil
+	}
+
+	if _, err := compilePatterns(f.Include); err != nil {
+		return err
+	}
+
+	if _, err := compilePatterns(f.Exclude); err != nil {
+		return err
+	}
+
+	for _, mimeType := range f.MimeTypes {
+		if _, err := path.Match(mimeType, ""); err != nil {
+			return fmt.Errorf("invalid mime type pattern '%s'. %v", mimeType, err)
+		}
+	}
+
+	return nil
+}
+
+// Apply splits the files into the ones which pass the filter and the ones
+// which are skipped.
+func (f *Filter) Apply(files []*DriveFile) ([]*DriveFile, []*DriveFile, error) {
+	if f == nil {
+		return files, nil, nil
+	}
+
+	include, err := compilePatterns(f.Include)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	exclude, err := compilePatterns(f.Exclude)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var kept []*DriveFile
+	var skipped []*DriveFile
+
+	for _, driveFile := range files {
+		if f.matches(driveFile, include, exclude) {
+			kept = append(kept, driveFile)
+			continue
+		}
+
+		skipped = append(skipped, driveFile)
+	}
+
+	return kept, skipped, nil
+}
+
+func (f *Filter) matches(driveFile *DriveFile, include []patternMatcher, exclude []patternMatcher) bool {
+	filePath := filepath.ToSlash(driveFile.Path)
+
+	if len(include) > 0 && !matchesAny(include, filePath) {
+		return false
+	}
+
+	if matchesAny(exclude, filePath) {
+		return false
+	}
+
+	if f.MinSize > 0 && driveFile.Remote.Size < f.MinSize {
+		return false
+	}
+
+	if f.MaxSize > 0 && driveFile.Remote.Size > f.MaxSize {
+		return false
+	}
+
+	if len(f.MimeTypes) > 0 && !matchesMimeType(f.MimeTypes, driveFile.Remote.MimeType) {
+		return false
+	}
+
+	if f.MaxDepth > 0 && strings.Count(filePath, "/")+1 > f.MaxDepth {
+		return false
+	}
+
+	return true
+}
+
+func matchesAny(matchers []patternMatcher, filePath string) bool {
+	for _, match := range matchers {
+		if match(filePath) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchesMimeType(patterns []string, mimeType string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, mimeType); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func compilePatterns(patterns []string) ([]patternMatcher, error) {
+	var matchers []patternMatcher
+
+	for _, pattern := range patterns {
+		matcher, err := compilePattern(pattern)
+
+		if err != nil {
+			return nil, err
+		}
+
+		matchers = append(matchers, matcher)
+	}
+
+	return matchers, nil
+}
+
+// compilePattern turns a pattern into a matcher. Regular expressions are
+// matched against the relative path of a file. Globs are matched against the
+// file name, or against the relative path when they contain a separator.
+func compilePattern(pattern string) (patternMatcher, error) {
+	if strings.HasPrefix(pattern, regexPatternPrefix) {
+		regex, err := regexp.Compile(strings.TrimPrefix(pattern, regexPatternPrefix))
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression '%s'. %v", pattern, err)
+		}
+
+		return regex.MatchString, nil
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob pattern '%s'. %v", pattern, err)
+	}
+
+	matchPath := strings.Contains(pattern, "/")
+
+	return func(filePath string) bool {
+		if !matchPath {
+			filePath = path.Base(filePath)
+		}
+
+		ok, _ := path.Match(pattern, filePath)
+
+		return ok
+	}, nil
+}
@@ -7,15 +7,37 @@ import (
 	"google.golang.org/api/drive/v3"
 )
 
-const mimeTypeFolder = "application/vnd.google-apps.folder"
+const (
+	mimeTypeFolder   = "application/vnd.google-apps.folder"
+	mimeTypeShortcut = "application/vnd.google-apps.shortcut"
+
+	fileFields = "id, name, size, md5Checksum, sha1Checksum, sha256Checksum, mimeType, trashed, modifiedTime, createdTime, description, shortcutDetails(targetId, targetMimeType)"
+)
 
 func (s *DriveService) GetFiles(folder *drive.File) ([]*DriveFile, error) {
-	return s.getFiles(folder, "")
+	return s.getFiles(folder, nil, map[string]bool{})
+}
+
+// DriveFolder is a folder below the folder of a job.
+type DriveFolder struct {
+	Remote *drive.File
+	Path   string
+	Parent *DriveFolder
+
+	// RemotePath is the path of the folder made of the original names of the
+	// Google Drive items.
+	RemotePath string
 }
 
-func (s *DriveService) getFiles(folder *drive.File, path string) ([]*DriveFile, error) {
+// getFiles lists the files of the folder recursively. parent is nil for the
+// folder of the job itself.
+func (s *DriveService) getFiles(folder *drive.File, parent *DriveFolder, ancestors map[string]bool) ([]*DriveFile, error) {
 	var driveFiles []*DriveFile
 	var nextPageToken string
+	usedNames := make(map[string]bool)
+
+	ancestors[folder.Id] = true
+	defer delete(ancestors, folder.Id)
 
 	for {
 		query := fmt.Sprintf("'%s' in parents", folder.Id)
@@ -33,15 +55,45 @@ func (s *DriveService) getFiles(folder *drive.File, path string) ([]*DriveFile,
 		}
 
 		for _, driveFile := range fileList.Files {
+			if isDriveShortcut(driveFile) {
+				target, err := s.resolveShortcut(driveFile, ancestors)
+
+				if err != nil {
+					return nil, err
+				}
+
+				if target == nil {
+					continue
+				}
+
+				driveFile = target
+			}
+
+			name, err := s.getLocalName(driveFile, usedNames)
+
+			if err != nil {
+				return nil, err
+			}
+
 			if !isDriveFolder(driveFile) {
 				driveFiles = append(driveFiles, &DriveFile{
-					Remote: driveFile,
-					Path:   filepath.Join(path, driveFile.Name),
+					Remote:     driveFile,
+					Path:       parent.join(name),
+					RemotePath: parent.joinRemote(driveFile.Name),
+					Parent:     parent,
+					FolderId:   folder.Id,
 				})
 				continue
 			}
 
-			files, err := s.getFiles(driveFile, filepath.Join(path, driveFile.Name))
+			subfolder := &DriveFolder{
+				Remote:     driveFile,
+				Path:       parent.join(name),
+				RemotePath: parent.joinRemote(driveFile.Name),
+				Parent:     parent,
+			}
+
+			files, err := s.getFiles(driveFile, subfolder, ancestors)
 
 			if err != nil {
 				return nil, err
@@ -60,6 +112,50 @@ func (s *DriveService) getFiles(folder *drive.File, path string) ([]*DriveFile,
 	return driveFiles, nil
 }
 
+// resolveShortcut returns the file or folder the shortcut points to. The
+// target is named after the shortcut so it ends up where the user expects it.
+// nil is returned when the shortcut should be skipped.
+func (s *DriveService) resolveShortcut(shortcut *drive.File, ancestors map[string]bool) (*drive.File, error) {
+	if s.conf.GDrive.SkipShortcuts {
+		s.logger.Infof("skipping shortcut (name: %s, id: %s)", shortcut.Name, shortcut.Id)
+		return nil, nil
+	}
+
+	if shortcut.ShortcutDetails == nil {
+		s.logger.Warnf("shortcut has no target (name: %s, id: %s)", shortcut.Name, shortcut.Id)
+		return nil, nil
+	}
+
+	targetId := shortcut.ShortcutDetails.TargetId
+
+	if ancestors[targetId] {
+		s.logger.Warnf("skipping shortcut which points to one of its parent folders (name: %s, id: %s)", shortcut.Name, shortcut.Id)
+		return nil, nil
+	}
+
+	target, err := s.requestFile(targetId)
+
+	// a target which was deleted or is not shared with the account only
+	// breaks the shortcut, not the folder.
+	if isInaccessibleError(err) {
+		s.logger.Warnf("skipping shortcut whose target can not be fetched (name: %s, id: %s). %v", shortcut.Name, shortcut.Id, err)
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if target.Trashed {
+		s.logger.Warnf("skipping shortcut whose target is trashed (name: %s, id: %s)", shortcut.Name, shortcut.Id)
+		return nil, nil
+	}
+
+	target.Name = shortcut.Name
+
+	return target, nil
+}
+
 func (s *DriveService) GetFolder(folderId string) (*drive.File, error) {
 	driveFile, err := s.requestFile(folderId)
 
@@ -77,19 +173,43 @@ func (s *DriveService) GetFolder(folderId string) (*drive.File, error) {
 	return driveFile, nil
 }
 
+func (folder *DriveFolder) join(name string) string {
+	if folder == nil {
+		return name
+	}
+
+	return filepath.Join(folder.Path, name)
+}
+
+// joinRemote joins the original names of Google Drive items. They are always
+// separated by a slash, regardless of the operating system.
+func (folder *DriveFolder) joinRemote(name string) string {
+	if folder == nil {
+		return name
+	}
+
+	return folder.RemotePath + "/" + name
+}
+
 func isDriveFolder(driveFile *drive.File) bool {
 	return driveFile.MimeType == mimeTypeFolder
 }
 
+func isDriveShortcut(driveFile *drive.File) bool {
+	return driveFile.MimeType == mimeTypeShortcut
+}
+
 func (s *DriveService) requestFile(id string) (*drive.File, error) {
 	serviceGetCall := s.drive.Files.Get(id).
 		SupportsAllDrives(true).
-		SupportsTeamDrives(true)
+		SupportsTeamDrives(true).
+		Fields(fileFields)
 
 	file, err := serviceGetCall.Do()
 
 	if err != nil {
 		s.logger.Errorf("failed to execute Google Drive api request. %v", err)
+		s.checkAuthError(err)
 		return nil, err
 	}
 
@@ -98,16 +218,16 @@ func (s *DriveService) requestFile(id string) (*drive.File, error) {
 
 func (s *DriveService) requestFiles(query string, nextPageToken string) (*drive.FileList, error) {
 	serviceListCall := s.drive.Files.List().
-		OrderBy("name").
+		OrderBy("name,createdTime").
 		PageSize(100).
 		SupportsAllDrives(true).
 		SupportsTeamDrives(true).
 		IncludeItemsFromAllDrives(true).
 		IncludeTeamDriveItems(true).
-		Fields("nextPageToken, files(id, name, size, md5Checksum, mimeType, trashed)").
+		Fields("nextPageToken, files(" + fileFields + ")").
 		Q(query)
 
-	if len(nextPageToken) == 0 {
+	if len(nextPageToken) > 0 {
 		serviceListCall.PageToken(nextPageToken)
 	}
 
@@ -115,6 +235,7 @@ func (s *DriveService) requestFiles(query string, nextPageToken string) (*drive.
 
 	if err != nil {
 		s.logger.Errorf("failed to execute Google Drive api request. %v", err)
+		s.checkAuthError(err)
 		return nil, err
 	}
 
@@ -0,0 +1,85 @@
+package gdrive
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"google.golang.org/api/drive/v3"
+)
+
+const (
+	// VerifyAlgorithmAuto selects the strongest checksum Google Drive provides
+	// for a file.
+	VerifyAlgorithmAuto   = "auto"
+	VerifyAlgorithmMd5    = "md5"
+	VerifyAlgorithmSha1   = "sha1"
+	VerifyAlgorithmSha256 = "sha256"
+
+	// VerifyAlgorithmSize is recorded for files without any checksum. Only
+	// their size is verified.
+	VerifyAlgorithmSize = "size"
+)
+
+// GetVerifyAlgorithm returns the algorithm which is used to verify the file
+// and the expected checksum. When the configured algorithm is not available
+// for the file the strongest available one is used.
+func (ds *DriveService) GetVerifyAlgorithm(remote *drive.File) (string, string) {
+	checksums := map[string]string{
+		VerifyAlgorithmMd5:    remote.Md5Checksum,
+		VerifyAlgorithmSha1:   remote.Sha1Checksum,
+		VerifyAlgorithmSha256: remote.Sha256Checksum,
+	}
+
+	if checksum := checksums[ds.conf.Download.VerifyAlgorithm]; len(checksum) > 0 {
+		return ds.conf.Download.VerifyAlgorithm, checksum
+	}
+
+	for _, algorithm := range []string{VerifyAlgorithmSha256, VerifyAlgorithmSha1} {
+		if checksum := checksums[algorithm]; len(checksum) > 0 {
+			return algorithm, checksum
+		}
+	}
+
+	return VerifyAlgorithmMd5, remote.Md5Checksum
+}
+
+func newHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case VerifyAlgorithmSha1:
+		return sha1.New()
+	case VerifyAlgorithmSha256:
+		return sha256.New()
+	default:
+		return md5.New()
+	}
+}
+
+// GetChecksum calculates the checksum of the file at the given path with the
+// given algorithm.
+func GetChecksum(path string, algorithm string) (string, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	hash := newHash(algorithm)
+
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// GetMd5Checksum calculates the md5 checksum of the file at the given path.
+func GetMd5Checksum(path string) (string, error) {
+	return GetChecksum(path, VerifyAlgorithmMd5)
+}
@@ -0,0 +1,143 @@
+package gdrive
+
+import (
+	"encoding"
+	"encoding/json"
+	"hash"
+	"io"
+	"os"
+)
+
+const (
+	// HashStateFileSuffix is appended to the path of a part file to get the
+	// path of the file which stores the hash state of its content.
+	HashStateFileSuffix = ".hashstate"
+
+	// hashStateSaveBytes defines after how many written bytes the hash state
+	// is saved again.
+	hashStateSaveBytes = 64 << 20
+)
+
+// hashState is the state of the hash of the first Offset bytes of a part file.
+// It lets a resumed download hash only the bytes which are added.
+type hashState struct {
+	Algorithm string
+	Offset    int64
+	State     []byte
+}
+
+// HashStatePath returns the path of the file which stores the hash state of
+// the part file.
+func (driveFile *DriveFile) HashStatePath() string {
+	return driveFile.PartPath() + HashStateFileSuffix
+}
+
+// restoreHash returns the hash of the content of the part file. The saved hash
+// state is used for the bytes it covers, the remaining bytes are read from the
+// part file.
+func (ds *DriveService) restoreHash(driveFile *DriveFile, algorithm string) (hash.Hash, error) {
+	hash := newHash(algorithm)
+	offset := int64(0)
+
+	if state, err := readHashState(driveFile.HashStatePath()); err == nil && state.Algorithm == algorithm && state.Offset <= driveFile.Size {
+		if err := hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(state.State); err == nil {
+			offset = state.Offset
+		} else {
+			hash.Reset()
+		}
+	}
+
+	if offset == driveFile.Size {
+		return hash, nil
+	}
+
+	if _, err := driveFile.Descriptor.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(hash, io.LimitReader(driveFile.Descriptor, driveFile.Size-offset)); err != nil {
+		return nil, err
+	}
+
+	return hash, nil
+}
+
+// saveHashState stores the state of the hash of the first offset bytes of the
+// part file.
+func saveHashState(driveFile *DriveFile, algorithm string, hash hash.Hash, offset int64) error {
+	state, err := hash.(encoding.BinaryMarshaler).MarshalBinary()
+
+	if err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(&hashState{Algorithm: algorithm, Offset: offset, State: state})
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(driveFile.HashStatePath(), buf, 0644)
+}
+
+func readHashState(path string) (*hashState, error) {
+	buf, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	state := &hashState{}
+
+	return state, json.Unmarshal(buf, state)
+}
+
+func removeHashState(driveFile *DriveFile) error {
+	if err := os.Remove(driveFile.HashStatePath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// hashStateWriter saves the hash state while the content of a file is written.
+// It has to be written to after the part file and the hash.
+type hashStateWriter struct {
+	ds        *DriveService
+	driveFile *DriveFile
+	algorithm string
+	hash      hash.Hash
+	offset    int64
+	unsaved   int64
+}
+
+func (ds *DriveService) newHashStateWriter(driveFile *DriveFile, algorithm string, hash hash.Hash) *hashStateWriter {
+	return &hashStateWriter{ds: ds, driveFile: driveFile, algorithm: algorithm, hash: hash, offset: driveFile.Size}
+}
+
+func (hw *hashStateWriter) Write(p []byte) (int, error) {
+	hw.offset += int64(len(p))
+	hw.unsaved += int64(len(p))
+
+	if hw.unsaved >= hashStateSaveBytes {
+		hw.save()
+	}
+
+	return len(p), nil
+}
+
+// save stores the hash state. The part file is synced first, so the state
+// never covers content which is lost on a crash. A failure is only logged
+// since the hash can always be calculated from the part file again.
+func (hw *hashStateWriter) save() {
+	hw.unsaved = 0
+
+	if err := hw.driveFile.Descriptor.Sync(); err != nil {
+		hw.ds.logger.Warnf("failed to sync part file. %v", err)
+		return
+	}
+
+	if err := saveHashState(hw.driveFile, hw.algorithm, hw.hash, hw.offset); err != nil {
+		hw.ds.logger.Warnf("failed to save hash state. %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+package gdrive
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/api/drive/v3"
+)
+
+const (
+	CollisionStrategySuffix  = "suffix"
+	CollisionStrategyDriveId = "driveId"
+	CollisionStrategyFail    = "fail"
+
+	SanitizeModePosix   = "posix"
+	SanitizeModeWindows = "windows"
+
+	defaultMaxNameLength = 255
+	replacementCharacter = "_"
+)
+
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SanitizeName turns the name of a Google Drive item into a name which can be
+// used as a single path element. Separators, NUL and control characters are
+// replaced. The windows mode additionally replaces characters which are not
+// allowed on Windows, trims trailing dots and spaces and escapes reserved
+// device names. Names longer than maxLength bytes are truncated while their
+// extension is preserved.
+func SanitizeName(name string, mode string, maxLength int) string {
+	name = strings.ToValidUTF8(name, replacementCharacter)
+
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '/' || r == '\\' {
+			return '_'
+		}
+
+		if mode == SanitizeModeWindows && strings.ContainsRune(`<>:"|?*`, r) {
+			return '_'
+		}
+
+		return r
+	}, name)
+
+	if mode == SanitizeModeWindows {
+		name = strings.TrimRight(name, ". ")
+
+		base := strings.ToUpper(strings.SplitN(name, ".", 2)[0])
+
+		if windowsReservedNames[base] {
+			name = replacementCharacter + name
+		}
+	}
+
+	if len(name) == 0 || name == "." || name == ".." {
+		name = replacementCharacter
+	}
+
+	return truncateName(name, maxLength)
+}
+
+// truncateName shortens the name to at most maxLength bytes without splitting
+// a multi-byte character. The extension is kept if it is reasonably short.
+func truncateName(name string, maxLength int) string {
+	if maxLength <= 0 {
+		maxLength = defaultMaxNameLength
+	}
+
+	if len(name) <= maxLength {
+		return name
+	}
+
+	extension := filepath.Ext(name)
+
+	if len(extension) > maxLength/2 {
+		extension = ""
+	}
+
+	base := name[:len(name)-len(extension)]
+
+	return truncateBytes(base, maxLength-len(extension)) + extension
+}
+
+// truncateBytes shortens the string to at most n bytes without splitting a
+// multi-byte character.
+func truncateBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	s = s[:n]
+
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+
+	return s
+}
+
+// EnsureContained returns an error when the path is not located inside of the
+// root directory.
+func EnsureContained(root string, path string) error {
+	relativePath, err := filepath.Rel(root, path)
+
+	if err != nil {
+		return err
+	}
+
+	if relativePath == ".." || strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("path '%s' is not located inside of '%s'", path, root)
+	}
+
+	return nil
+}
+
+// ResolveNameCollision returns an alternative for a name which is already used
+// by another item in the same folder. n counts the collisions of the name and
+// starts at 1. The extension of files is preserved.
+func ResolveNameCollision(name string, id string, n int, isFile bool, strategy string) (string, error) {
+	var suffix string
+
+	switch strategy {
+	case CollisionStrategyDriveId:
+		suffix = id
+
+		if n > 1 {
+			suffix = fmt.Sprintf("%s-%d", id, n-1)
+		}
+	case CollisionStrategyFail:
+		return "", fmt.Errorf("name '%s' is used by more than one item (id: %s)", name, id)
+	default:
+		suffix = fmt.Sprint(n)
+	}
+
+	extension := ""
+
+	if isFile {
+		extension = filepath.Ext(name)
+	}
+
+	base := name[:len(name)-len(extension)]
+
+	return fmt.Sprintf("%s (%s)%s", base, suffix, extension), nil
+}
+
+// GetSanitizedName returns the configured local representation of a name.
+func (s *DriveService) GetSanitizedName(name string) string {
+	return SanitizeName(name, s.conf.Download.SanitizeMode, s.conf.Download.MaxNameLength)
+}
+
+// getLocalName returns a safe name for the file which is not yet used in its
+// folder.
+func (s *DriveService) getLocalName(driveFile *drive.File, usedNames map[string]bool) (string, error) {
+	sanitizedName := s.GetSanitizedName(driveFile.Name)
+	name := sanitizedName
+
+	for n := 1; usedNames[s.getNameKey(name)]; n++ {
+		var err error
+
+		name, err = s.resolveNameCollision(sanitizedName, driveFile, n)
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if name != driveFile.Name {
+		s.logger.Warnf("renaming '%s' to '%s' because the name is already used or not allowed (id: %s)", driveFile.Name, name, driveFile.Id)
+	}
+
+	usedNames[s.getNameKey(name)] = true
+
+	return name, nil
+}
+
+// getNameKey returns the key of the name in the used names of a folder. Names
+// which only differ in case collide on the file systems of Windows and macOS.
+func (s *DriveService) getNameKey(name string) string {
+	if s.conf.Download.SanitizeMode == SanitizeModeWindows || runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		return strings.ToLower(name)
+	}
+
+	return name
+}
+
+// resolveNameCollision resolves the collision of a sanitized name. The name is
+// shortened in front of the extension of a file when the suffix would exceed
+// the maximum name length.
+func (s *DriveService) resolveNameCollision(name string, driveFile *drive.File, n int) (string, error) {
+	maxLength := s.conf.Download.MaxNameLength
+
+	if maxLength <= 0 {
+		maxLength = defaultMaxNameLength
+	}
+
+	isFile := !isDriveFolder(driveFile)
+	extension := ""
+
+	if isFile {
+		extension = filepath.Ext(name)
+	}
+
+	for {
+		resolvedName, err := ResolveNameCollision(name, driveFile.Id, n, isFile, s.conf.Download.CollisionStrategy)
+
+		if err != nil {
+			return "", err
+		}
+
+		base := name[:len(name)-len(extension)]
+		overflow := len(resolvedName) - maxLength
+
+		if overflow <= 0 || overflow >= len(base) {
+			return s.GetSanitizedName(resolvedName), nil
+		}
+
+		name = truncateBytes(base, len(base)-overflow) + extension
+	}
+}
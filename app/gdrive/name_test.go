@@ -0,0 +1,221 @@
+package gdrive
+
+import (
+	"path/filepath"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/gogdl-ng/gogdl-ng/app/config"
+	"google.golang.org/api/drive/v3"
+)
+
+type testLogger struct{}
+
+func (testLogger) Info(...interface{})           {}
+func (testLogger) Infof(string, ...interface{})  {}
+func (testLogger) Warnf(string, ...interface{})  {}
+func (testLogger) Error(...interface{})          {}
+func (testLogger) Errorf(string, ...interface{}) {}
+func (testLogger) Fatal(...interface{})          {}
+func (testLogger) Fatalf(string, ...interface{}) {}
+
+func newTestDriveService(download config.DownloadConfiguration) *DriveService {
+	return &DriveService{logger: testLogger{}, conf: &config.Configuration{Download: download}}
+}
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      string
+		maxLength int
+		want      string
+	}{
+		{name: "report.pdf", mode: SanitizeModePosix, want: "report.pdf"},
+		{name: "../etc/passwd", mode: SanitizeModePosix, want: ".._etc_passwd"},
+		{name: `..\windows`, mode: SanitizeModePosix, want: ".._windows"},
+		{name: "..", mode: SanitizeModePosix, want: "_"},
+		{name: ".", mode: SanitizeModePosix, want: "_"},
+		{name: "", mode: SanitizeModePosix, want: "_"},
+		{name: "a\x00b", mode: SanitizeModePosix, want: "a_b"},
+		{name: "a\nb\x7f", mode: SanitizeModePosix, want: "a_b_"},
+		{name: "a\xffb", mode: SanitizeModePosix, want: "a_b"},
+		{name: "CON", mode: SanitizeModePosix, want: "CON"},
+		{name: `a<b>c:d"e|f?g*h`, mode: SanitizeModePosix, want: `a<b>c:d"e|f?g*h`},
+		{name: "CON", mode: SanitizeModeWindows, want: "_CON"},
+		{name: "con.txt", mode: SanitizeModeWindows, want: "_con.txt"},
+		{name: "LPT1.tar.gz", mode: SanitizeModeWindows, want: "_LPT1.tar.gz"},
+		{name: "CONSOLE.txt", mode: SanitizeModeWindows, want: "CONSOLE.txt"},
+		{name: "NUL. ", mode: SanitizeModeWindows, want: "_NUL"},
+		{name: "notes. . ", mode: SanitizeModeWindows, want: "notes"},
+		{name: "...", mode: SanitizeModeWindows, want: "_"},
+		{name: `a<b>c:d"e|f?g*h`, mode: SanitizeModeWindows, want: "a_b_c_d_e_f_g_h"},
+		{name: "abcdefghij.txt", mode: SanitizeModePosix, maxLength: 10, want: "abcdef.txt"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.mode+"/"+test.name, func(t *testing.T) {
+			if got := SanitizeName(test.name, test.mode, test.maxLength); got != test.want {
+				t.Errorf("SanitizeName(%q) = %q, want %q", test.name, got, test.want)
+			}
+		})
+	}
+}
+
+func TestTruncateName(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxLength int
+		want      string
+	}{
+		{name: "short.txt", maxLength: 20, want: "short.txt"},
+		{name: "abcdefghij.txt", maxLength: 10, want: "abcdef.txt"},
+		{name: "abcdefghij", maxLength: 4, want: "abcd"},
+		{name: "abc.verylongextension", maxLength: 10, want: "abc.verylo"},
+		{name: "日本語.txt", maxLength: 10, want: "日本.txt"},
+		{name: "日本語.txt", maxLength: 9, want: "日.txt"},
+		{name: "日本語.txt", maxLength: 8, want: "日.txt"},
+		{name: "äöü", maxLength: 5, want: "äö"},
+		{name: "😀😀", maxLength: 7, want: "😀"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := truncateName(test.name, test.maxLength)
+
+			if got != test.want {
+				t.Errorf("truncateName(%q, %d) = %q, want %q", test.name, test.maxLength, got, test.want)
+			}
+
+			if len(got) > test.maxLength || !utf8.ValidString(got) {
+				t.Errorf("truncateName(%q, %d) = %q is too long or not valid UTF-8", test.name, test.maxLength, got)
+			}
+		})
+	}
+}
+
+func TestEnsureContained(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "completed")
+
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{path: root},
+		{path: filepath.Join(root, "folder")},
+		{path: filepath.Join(root, "folder", "..", "other")},
+		{path: filepath.Join(root, "..foo")},
+		{path: filepath.Join(root, ".."), wantErr: true},
+		{path: filepath.Join(root, "..", "other"), wantErr: true},
+		{path: root + "-other", wantErr: true},
+		{path: filepath.Dir(root), wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			if err := EnsureContained(root, test.path); (err != nil) != test.wantErr {
+				t.Errorf("EnsureContained(%q) = %v, want error: %v", test.path, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolveNameCollision(t *testing.T) {
+	tests := []struct {
+		name     string
+		n        int
+		isFile   bool
+		strategy string
+		want     string
+		wantErr  bool
+	}{
+		{name: "a.txt", n: 1, isFile: true, strategy: CollisionStrategySuffix, want: "a (1).txt"},
+		{name: "a.txt", n: 2, isFile: true, strategy: CollisionStrategySuffix, want: "a (2).txt"},
+		{name: "a.b", n: 1, isFile: false, strategy: CollisionStrategySuffix, want: "a.b (1)"},
+		{name: "a.txt", n: 1, isFile: true, strategy: CollisionStrategyDriveId, want: "a (id).txt"},
+		{name: "a.txt", n: 3, isFile: true, strategy: CollisionStrategyDriveId, want: "a (id-2).txt"},
+		{name: "a.txt", n: 1, isFile: true, strategy: CollisionStrategyFail, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.strategy+"/"+test.want, func(t *testing.T) {
+			got, err := ResolveNameCollision(test.name, "id", test.n, test.isFile, test.strategy)
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ResolveNameCollision(%q, %d) returned error %v, want error: %v", test.name, test.n, err, test.wantErr)
+			}
+
+			if got != test.want {
+				t.Errorf("ResolveNameCollision(%q, %d) = %q, want %q", test.name, test.n, got, test.want)
+			}
+		})
+	}
+}
+
+func TestResolveNameCollisionNearMaxLength(t *testing.T) {
+	tests := []struct {
+		name      string
+		id        string
+		n         int
+		maxLength int
+		strategy  string
+		want      string
+	}{
+		{name: "abcdefgh.txt", n: 1, maxLength: 12, strategy: CollisionStrategySuffix, want: "abcd (1).txt"},
+		{name: "abcdefgh.txt", n: 10, maxLength: 12, strategy: CollisionStrategySuffix, want: "abc (10).txt"},
+		{name: "abcdefgh", n: 1, maxLength: 8, strategy: CollisionStrategySuffix, want: "abcd (1)"},
+		{name: "äääää.txt", n: 1, maxLength: 14, strategy: CollisionStrategySuffix, want: "äää (1).txt"},
+		{name: "a.txt", id: "0123456789", n: 1, maxLength: 12, strategy: CollisionStrategyDriveId, want: "a (01234.txt"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			ds := newTestDriveService(config.DownloadConfiguration{MaxNameLength: test.maxLength, CollisionStrategy: test.strategy})
+			driveFile := &drive.File{Id: test.id, Name: test.name}
+
+			got, err := ds.resolveNameCollision(test.name, driveFile, test.n)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != test.want {
+				t.Errorf("resolveNameCollision(%q, %d) = %q, want %q", test.name, test.n, got, test.want)
+			}
+
+			if len(got) > test.maxLength || !utf8.ValidString(got) {
+				t.Errorf("resolveNameCollision(%q, %d) = %q is too long or not valid UTF-8", test.name, test.n, got)
+			}
+		})
+	}
+}
+
+func TestGetLocalName(t *testing.T) {
+	tests := []struct {
+		mode  string
+		names []string
+		want  []string
+	}{
+		{mode: SanitizeModeWindows, names: []string{"a.txt", "A.TXT", "a.txt"}, want: []string{"a.txt", "A (1).TXT", "a (2).txt"}},
+		{mode: SanitizeModeWindows, names: []string{"a:b", "a?b"}, want: []string{"a_b", "a_b (1)"}},
+		{mode: SanitizeModePosix, names: []string{"a/b", "a_b"}, want: []string{"a_b", "a_b (1)"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.mode, func(t *testing.T) {
+			ds := newTestDriveService(config.DownloadConfiguration{SanitizeMode: test.mode, CollisionStrategy: CollisionStrategySuffix})
+			usedNames := make(map[string]bool)
+
+			for i, name := range test.names {
+				got, err := ds.getLocalName(&drive.File{Id: "id", Name: name}, usedNames)
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got != test.want[i] {
+					t.Errorf("getLocalName(%q) = %q, want %q", name, got, test.want[i])
+				}
+			}
+		})
+	}
+}
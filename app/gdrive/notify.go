@@ -0,0 +1,46 @@
+package gdrive
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	EventAuthExpired = "auth.expired"
+
+	// authNotificationInterval limits how often an expired authorization is
+	// reported, since every api request fails until the token was renewed.
+	authNotificationInterval = time.Hour
+)
+
+// Notifier receives events of the drive service.
+type Notifier interface {
+	Notify(event string, message string, data interface{})
+}
+
+func (ds *DriveService) SetNotifier(notifier Notifier) {
+	ds.notifier = notifier
+}
+
+// checkAuthError notifies about an expired or revoked authorization when the
+// token could not be refreshed.
+func (ds *DriveService) checkAuthError(err error) {
+	var retrieveError *oauth2.RetrieveError
+
+	if ds.notifier == nil || !errors.As(err, &retrieveError) {
+		return
+	}
+
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	if time.Since(ds.authNotifiedAt) < authNotificationInterval {
+		return
+	}
+
+	ds.authNotifiedAt = time.Now()
+	ds.logger.Errorf("the Google Drive authorization expired. %v", err)
+	ds.notifier.Notify(EventAuthExpired, "The Google Drive authorization expired or was revoked. Please renew the token.", nil)
+}
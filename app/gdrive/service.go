@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/gogdl-ng/gogdl-ng/app/config"
 	"github.com/gogdl-ng/gogdl-ng/app/logging"
@@ -26,6 +28,10 @@ type DriveService struct {
 	logger logging.Logger
 	conf   *config.Configuration
 	drive  *drive.Service
+
+	notifier       Notifier
+	mutex          sync.Mutex
+	authNotifiedAt time.Time
 }
 
 func NewDriveService(conf *config.Configuration, logger logging.Logger) (*DriveService, error) {
@@ -0,0 +1,88 @@
+package gdrive
+
+import (
+	"io"
+	"time"
+
+	"github.com/gogdl-ng/gogdl-ng/app/disk"
+)
+
+// diskSpaceCheckBytes defines after how many written bytes the free disk
+// space is checked again.
+const diskSpaceCheckBytes = 64 * disk.Megabyte
+
+// reserveWriter pauses writing while the free disk space of the volume is
+// below the configured reserve.
+type reserveWriter struct {
+	ds        *DriveService
+	driveFile *DriveFile
+	path      string
+	unchecked int64
+}
+
+func (ds *DriveService) newReserveWriter(driveFile *DriveFile, path string) io.Writer {
+	return &reserveWriter{ds: ds, driveFile: driveFile, path: path}
+}
+
+func (rw *reserveWriter) Write(p []byte) (int, error) {
+	if rw.unchecked >= diskSpaceCheckBytes {
+		if err := rw.ds.waitForDiskSpace(rw.driveFile, rw.path); err != nil {
+			return 0, err
+		}
+
+		rw.unchecked = 0
+	}
+
+	n, err := rw.driveFile.Descriptor.Write(p)
+	rw.unchecked += int64(n)
+
+	return n, err
+}
+
+// waitForDiskSpace blocks until the free disk space of the volume is above the
+// configured reserve. It returns ErrCancelled when the job of the file was
+// cancelled in the meantime.
+func (ds *DriveService) waitForDiskSpace(driveFile *DriveFile, path string) error {
+	reserve := ds.conf.Download.ReservedDiskSpace * disk.Megabyte
+
+	if reserve == 0 {
+		return nil
+	}
+
+	interval := time.Duration(ds.conf.Download.DiskSpaceCheckInterval) * time.Second
+
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	paused := false
+
+	for {
+		freeSpace, err := disk.FreeSpace(path)
+
+		if err != nil {
+			ds.logger.Errorf("failed to determine free disk space. %v", err)
+			return nil
+		}
+
+		if freeSpace >= reserve {
+			if paused {
+				ds.logger.Infof("resuming download. %d bytes are free in '%s'", freeSpace, path)
+			}
+
+			return nil
+		}
+
+		if driveFile.Cancelled != nil && driveFile.Cancelled() {
+			ds.logger.Infof("stopped waiting for disk space. job of file '%s' was cancelled", driveFile.Remote.Name)
+			return ErrCancelled
+		}
+
+		if !paused {
+			ds.logger.Warnf("pausing download. only %d bytes are free in '%s' (reserve: %d bytes)", freeSpace, path, reserve)
+			paused = true
+		}
+
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,88 @@
+package gdrive
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+)
+
+const reasonNotFound = "notFound"
+
+// isStaleMetadataError reports whether the error can be caused by a file which
+// was replaced after the folder was listed.
+func isStaleMetadataError(err error) bool {
+	reason := ClassifyError(err).Reason
+
+	return reason == reasonNotFound || errors.Is(err, ErrChecksumMismatch)
+}
+
+// refreshMetadata fetches the current metadata of the file. When the file was
+// deleted, a file with the same name in the same folder is taken as its
+// replacement. It reports whether the metadata changed.
+func (ds *DriveService) refreshMetadata(driveFile *DriveFile) (bool, error) {
+	remote, err := ds.requestFile(driveFile.Remote.Id)
+
+	if err != nil && ClassifyError(err).Reason != reasonNotFound {
+		return false, err
+	}
+
+	if err != nil || remote.Trashed {
+		remote, err = ds.findFileByName(driveFile.FolderId, driveFile.Remote.Name)
+
+		if err != nil || remote == nil {
+			return false, err
+		}
+	}
+
+	previous := driveFile.Remote
+
+	if remote.Id == previous.Id && remote.Md5Checksum == previous.Md5Checksum && remote.Size == previous.Size {
+		return false, nil
+	}
+
+	// the local path stays the same, even when the replacement has another
+	// name or is the target of a shortcut.
+	remote.Name = previous.Name
+
+	ds.logger.Warnf("file '%s' was replaced in Google Drive (id: %s -> %s, size: %d -> %d, md5: %s -> %s)",
+		previous.Name, previous.Id, remote.Id, previous.Size, remote.Size, previous.Md5Checksum, remote.Md5Checksum)
+
+	driveFile.PreviousRemote = previous
+	driveFile.Remote = remote
+
+	return true, nil
+}
+
+// findFileByName returns the file with the given name in the folder. nil is
+// returned when there is no such file.
+func (ds *DriveService) findFileByName(folderId string, name string) (*drive.File, error) {
+	escapedName := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(name)
+	query := fmt.Sprintf("'%s' in parents and name = '%s' and trashed = false and mimeType != '%s'", folderId, escapedName, mimeTypeFolder)
+
+	fileList, err := ds.requestFiles(query, "")
+
+	if err != nil || len(fileList.Files) == 0 {
+		return nil, err
+	}
+
+	remote := fileList.Files[0]
+
+	if isDriveShortcut(remote) && remote.ShortcutDetails != nil {
+		return ds.requestFile(remote.ShortcutDetails.TargetId)
+	}
+
+	return remote, nil
+}
+
+// removePartFile deletes the part file and its hash state, so the file is
+// downloaded from the start.
+func removePartFile(driveFile *DriveFile) error {
+	if err := os.Remove(driveFile.PartPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return removeHashState(driveFile)
+}
@@ -0,0 +1,45 @@
+package gdrive
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var driveIdPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{10,}$`)
+
+// ParseDriveId extracts the id of a Google Drive resource. Besides plain ids
+// it understands the URLs shown by the Google Drive web interface, e.g.
+// https://drive.google.com/drive/folders/<id> or https://drive.google.com/open?id=<id>.
+func ParseDriveId(value string) (string, error) {
+	value = strings.TrimSpace(value)
+
+	if driveIdPattern.MatchString(value) {
+		return value, nil
+	}
+
+	u, err := url.Parse(value)
+
+	if err != nil || len(u.Host) == 0 {
+		return "", fmt.Errorf("'%s' is neither a Google Drive id nor url", value)
+	}
+
+	if id := u.Query().Get("id"); driveIdPattern.MatchString(id) {
+		return id, nil
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	for i, segment := range segments {
+		if segment != "folders" && segment != "d" {
+			continue
+		}
+
+		if i+1 < len(segments) && driveIdPattern.MatchString(segments[i+1]) {
+			return segments[i+1], nil
+		}
+	}
+
+	return "", fmt.Errorf("failed to find a Google Drive id in url '%s'", value)
+}
@@ -0,0 +1,195 @@
+package watch
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gogdl-ng/gogdl-ng/app/download"
+	"github.com/gogdl-ng/gogdl-ng/app/gdrive"
+	"github.com/gogdl-ng/gogdl-ng/app/logging"
+)
+
+const tickInterval = time.Minute
+
+// Scheduler polls the watched folders and creates jobs for new files.
+type Scheduler struct {
+	logger     logging.Logger
+	drive      *gdrive.DriveService
+	jobManager *download.JobManager
+	store      *Store
+}
+
+func NewScheduler(logger logging.Logger, drive *gdrive.DriveService, jm *download.JobManager, store *Store) *Scheduler {
+	return &Scheduler{logger: logger, drive: drive, jobManager: jm, store: store}
+}
+
+func (s *Scheduler) Run() {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	for {
+		s.pollDueWatches()
+		<-ticker.C
+	}
+}
+
+func (s *Scheduler) pollDueWatches() {
+	for _, watch := range s.store.GetAll() {
+		interval, err := watch.GetInterval()
+
+		if err != nil {
+			s.logger.Errorf("invalid interval of watch (driveId: %s). %v", watch.DriveId, err)
+			continue
+		}
+
+		if time.Since(watch.LastPolledAt) < interval {
+			continue
+		}
+
+		updatedWatch, err := s.poll(watch)
+
+		if err != nil {
+			s.logger.Errorf("failed to poll watched folder (driveId: %s). %v", watch.DriveId, err)
+			continue
+		}
+
+		if err := s.store.Update(updatedWatch); err != nil {
+			s.logger.Errorf("failed to save watch (driveId: %s). %v", watch.DriveId, err)
+		}
+	}
+}
+
+// poll lists the files of the watched folder and creates a sync job for every
+// top level subfolder which contains new files. New files in the watched
+// folder itself are downloaded by a sync job of the watched folder. It returns
+// an updated copy of the watch.
+func (s *Scheduler) poll(watch *Watch) (*Watch, error) {
+	folder, err := s.drive.GetFolder(watch.DriveId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := s.drive.GetFiles(folder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	updatedWatch := *watch
+	updatedWatch.Name = folder.Name
+	updatedWatch.LastPolledAt = time.Now()
+	updatedWatch.KnownFileIds = append([]string{}, watch.KnownFileIds...)
+
+	knownFileIds := make(map[string]bool)
+
+	for _, id := range watch.KnownFileIds {
+		knownFileIds[id] = true
+	}
+
+	newFileIds := make(map[string][]string)
+
+	for _, driveFile := range files {
+		if knownFileIds[driveFile.Remote.Id] {
+			continue
+		}
+
+		folderId := folder.Id
+
+		if topFolder := getTopFolder(driveFile); topFolder != nil {
+			folderId = topFolder.Remote.Id
+		}
+
+		newFileIds[folderId] = append(newFileIds[folderId], driveFile.Remote.Id)
+	}
+
+	for folderId, fileIds := range newFileIds {
+		options := &download.JobOptions{}
+
+		if watch.Options != nil {
+			*options = *watch.Options
+		}
+
+		options.Mode = download.JobModeSync
+		options.FileIds = fileIds
+
+		err := s.jobManager.CreateJob(folderId, options)
+
+		// the new files are picked up again once the unfinished job is done.
+		if errors.Is(err, download.ErrJobExists) {
+			s.logger.Infof("postponing %d new file(s) of watched folder until its unfinished job is done (driveId: %s)", len(fileIds), folderId)
+			continue
+		}
+
+		if err != nil {
+			s.logger.Errorf("failed to create job for watched folder (driveId: %s). %v", folderId, err)
+			continue
+		}
+
+		s.logger.Infof("created job for %d new file(s) of watched folder (driveId: %s)", len(fileIds), folderId)
+		updatedWatch.KnownFileIds = append(updatedWatch.KnownFileIds, fileIds...)
+	}
+
+	return &updatedWatch, nil
+}
+
+// getTopFolder returns the subfolder of the watched folder which contains the
+// file. It is nil for files in the watched folder itself.
+func getTopFolder(driveFile *gdrive.DriveFile) *gdrive.DriveFolder {
+	folder := driveFile.Parent
+
+	for folder != nil && folder.Parent != nil {
+		folder = folder.Parent
+	}
+
+	return folder
+}
+
+// AddWatch validates and stores the watch. When ignoreExisting is set the
+// current files of the folder are not downloaded.
+func (s *Scheduler) AddWatch(watch *Watch, ignoreExisting bool) error {
+	if _, err := watch.GetInterval(); err != nil {
+		return err
+	}
+
+	if watch.Options == nil {
+		watch.Options = &download.JobOptions{}
+	}
+
+	if err := s.jobManager.ValidateOptions(watch.Options); err != nil {
+		return err
+	}
+
+	folder, err := s.drive.GetFolder(watch.DriveId)
+
+	if err != nil {
+		return err
+	}
+
+	watch.Name = folder.Name
+
+	if ignoreExisting {
+		files, err := s.drive.GetFiles(folder)
+
+		if err != nil {
+			return err
+		}
+
+		for _, driveFile := range files {
+			watch.KnownFileIds = append(watch.KnownFileIds, driveFile.Remote.Id)
+		}
+
+		watch.LastPolledAt = time.Now()
+	}
+
+	return s.store.Add(watch)
+}
+
+func (s *Scheduler) GetWatches() []*Watch {
+	return s.store.GetAll()
+}
+
+// RemoveWatch deletes the watch of the folder. It reports whether it existed.
+func (s *Scheduler) RemoveWatch(driveId string) (bool, error) {
+	return s.store.Remove(driveId)
+}
@@ -0,0 +1,143 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gogdl-ng/gogdl-ng/app/download"
+)
+
+const (
+	watchesFileName = "watches.json"
+	minimumInterval = time.Minute
+)
+
+// Watch is a Google Drive folder which is polled periodically. Jobs are
+// created for the files which were added to it since the last poll.
+type Watch struct {
+	DriveId  string
+	Name     string
+	Interval string
+	Options  *download.JobOptions
+
+	LastPolledAt time.Time
+	KnownFileIds []string
+}
+
+// Store persists the watches in the state directory.
+type Store struct {
+	mutex   sync.Mutex
+	path    string
+	watches []*Watch
+}
+
+func NewStore(stateDirectoryPath string) (*Store, error) {
+	store := &Store{path: filepath.Join(stateDirectoryPath, watchesFileName)}
+
+	buf, err := os.ReadFile(store.path)
+
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(buf, &store.watches); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// GetInterval returns the parsed poll interval of the watch.
+func (watch *Watch) GetInterval() (time.Duration, error) {
+	interval, err := time.ParseDuration(watch.Interval)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if interval < minimumInterval {
+		return 0, fmt.Errorf("interval must be at least %s", minimumInterval)
+	}
+
+	return interval, nil
+}
+
+func (store *Store) GetAll() []*Watch {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	watches := make([]*Watch, len(store.watches))
+	copy(watches, store.watches)
+
+	return watches
+}
+
+// Add stores the watch. An existing watch of the same folder is replaced.
+func (store *Store) Add(watch *Watch) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for i, w := range store.watches {
+		if w.DriveId == watch.DriveId {
+			store.watches[i] = watch
+			return store.save()
+		}
+	}
+
+	store.watches = append(store.watches, watch)
+
+	return store.save()
+}
+
+// Remove deletes the watch of the folder. It reports whether it existed.
+func (store *Store) Remove(driveId string) (bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for i, w := range store.watches {
+		if w.DriveId == driveId {
+			store.watches = append(store.watches[:i], store.watches[i+1:]...)
+			return true, store.save()
+		}
+	}
+
+	return false, nil
+}
+
+// Update replaces the stored watch of the same folder, unless it was removed
+// meanwhile.
+func (store *Store) Update(watch *Watch) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for i, w := range store.watches {
+		if w.DriveId == watch.DriveId {
+			store.watches[i] = watch
+			return store.save()
+		}
+	}
+
+	return nil
+}
+
+func (store *Store) save() error {
+	buf, err := json.MarshalIndent(store.watches, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(store.path), 0644); err != nil {
+		return err
+	}
+
+	return os.WriteFile(store.path, buf, 0644)
+}
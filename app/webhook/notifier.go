@@ -0,0 +1,399 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gogdl-ng/gogdl-ng/app/config"
+	"github.com/gogdl-ng/gogdl-ng/app/logging"
+)
+
+const (
+	webhooksFileName   = "webhooks.json"
+	deliveriesFileName = "webhook-deliveries.json"
+
+	signatureHeader = "X-Gogdl-Signature"
+	eventHeader     = "X-Gogdl-Event"
+
+	maxAttempts    = 10
+	initialBackoff = 10 * time.Second
+	maxBackoff     = time.Hour
+	requestTimeout = 30 * time.Second
+	pollInterval   = 5 * time.Second
+)
+
+// errWebhookRemoved is returned for a delivery whose webhook was removed in the
+// meantime. It is not retried.
+var errWebhookRemoved = errors.New("webhook was removed")
+
+// Delivery is a pending request to a webhook. Deliveries are persisted until
+// they succeeded or ran out of attempts, so they survive a restart. The secret
+// of the webhook is looked up when the request is sent, so it is not persisted
+// twice.
+type Delivery struct {
+	Id            string
+	WebhookId     string
+	Url           string
+	Event         string
+	Body          json.RawMessage
+	Attempts      int
+	NextAttemptAt time.Time
+}
+
+// Notifier sends events to the configured and registered webhooks.
+type Notifier struct {
+	logger logging.Logger
+	client *http.Client
+
+	mutex          sync.Mutex
+	webhooksPath   string
+	deliveriesPath string
+	configured     []*Webhook
+	registered     []*Webhook
+	deliveries     []*Delivery
+}
+
+func NewNotifier(logger logging.Logger, conf *config.Configuration) (*Notifier, error) {
+	notifier := &Notifier{
+		logger:         logger,
+		client:         &http.Client{Timeout: requestTimeout},
+		webhooksPath:   filepath.Join(conf.Paths.State, webhooksFileName),
+		deliveriesPath: filepath.Join(conf.Paths.State, deliveriesFileName),
+	}
+
+	for i, webhookConf := range conf.Webhooks {
+		webhook := &Webhook{
+			Id:         fmt.Sprintf("config-%d", i),
+			Url:        webhookConf.Url,
+			Secret:     webhookConf.Secret,
+			Template:   webhookConf.Template,
+			Events:     webhookConf.Events,
+			Configured: true,
+		}
+
+		if err := webhook.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid webhook '%s'. %v", webhook.Url, err)
+		}
+
+		notifier.configured = append(notifier.configured, webhook)
+	}
+
+	if err := readJsonFile(notifier.webhooksPath, &notifier.registered); err != nil {
+		return nil, err
+	}
+
+	if err := readJsonFile(notifier.deliveriesPath, &notifier.deliveries); err != nil {
+		return nil, err
+	}
+
+	return notifier, nil
+}
+
+// Notify queues a delivery of the event for every webhook which subscribed to
+// it.
+func (notifier *Notifier) Notify(event string, message string, data interface{}) {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+
+	for _, webhook := range notifier.getWebhooks() {
+		if !webhook.subscribes(event) {
+			continue
+		}
+
+		delivery, err := newDelivery(webhook, event, message, data)
+
+		if err != nil {
+			notifier.logger.Errorf("failed to create webhook delivery (url: %s). %v", webhook.Url, err)
+			continue
+		}
+
+		notifier.deliveries = append(notifier.deliveries, delivery)
+	}
+
+	notifier.saveDeliveries()
+}
+
+// Run sends the due deliveries until the application exits.
+func (notifier *Notifier) Run() {
+	for {
+		for _, delivery := range notifier.getDueDeliveries() {
+			err := notifier.send(delivery)
+			notifier.completeAttempt(delivery, err)
+		}
+
+		time.Sleep(pollInterval)
+	}
+}
+
+func (notifier *Notifier) GetWebhooks() []*Webhook {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+
+	var webhooks []*Webhook
+
+	for _, webhook := range notifier.getWebhooks() {
+		withoutSecret := *webhook
+		withoutSecret.Secret = ""
+		webhooks = append(webhooks, &withoutSecret)
+	}
+
+	return webhooks
+}
+
+func (notifier *Notifier) AddWebhook(webhook *Webhook) error {
+	if err := webhook.Validate(); err != nil {
+		return err
+	}
+
+	id, err := newId()
+
+	if err != nil {
+		return err
+	}
+
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+
+	webhook.Id = id
+	notifier.registered = append(notifier.registered, webhook)
+
+	return writeJsonFile(notifier.webhooksPath, notifier.registered)
+}
+
+// RemoveWebhook deletes a registered webhook. It reports whether it existed.
+func (notifier *Notifier) RemoveWebhook(id string) (bool, error) {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+
+	for i, webhook := range notifier.registered {
+		if webhook.Id == id {
+			notifier.registered = append(notifier.registered[:i], notifier.registered[i+1:]...)
+			return true, writeJsonFile(notifier.webhooksPath, notifier.registered)
+		}
+	}
+
+	return false, nil
+}
+
+// TestWebhook sends a test event to the webhook right away and returns the
+// result of the request.
+func (notifier *Notifier) TestWebhook(id string) (bool, error) {
+	notifier.mutex.Lock()
+	var webhook *Webhook
+
+	for _, w := range notifier.getWebhooks() {
+		if w.Id == id {
+			webhook = w
+		}
+	}
+
+	notifier.mutex.Unlock()
+
+	if webhook == nil {
+		return false, nil
+	}
+
+	delivery, err := newDelivery(webhook, EventTest, "This is a test event.", nil)
+
+	if err != nil {
+		return true, err
+	}
+
+	return true, notifier.send(delivery)
+}
+
+func (notifier *Notifier) getWebhooks() []*Webhook {
+	return append(append([]*Webhook{}, notifier.configured...), notifier.registered...)
+}
+
+func (notifier *Notifier) getDueDeliveries() []*Delivery {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+
+	var deliveries []*Delivery
+	now := time.Now()
+
+	for _, delivery := range notifier.deliveries {
+		if !delivery.NextAttemptAt.After(now) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	return deliveries
+}
+
+// completeAttempt removes a successful delivery. A failed one is retried with
+// an exponential backoff until it runs out of attempts.
+func (notifier *Notifier) completeAttempt(delivery *Delivery, err error) {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+
+	delivery.Attempts++
+
+	if err != nil && delivery.Attempts < maxAttempts && !errors.Is(err, errWebhookRemoved) {
+		backoff := initialBackoff << (delivery.Attempts - 1)
+
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+
+		delivery.NextAttemptAt = time.Now().Add(backoff)
+		notifier.logger.Warnf("failed to deliver webhook (url: %s, attempt: %d). retrying in %s. %v", delivery.Url, delivery.Attempts, backoff, err)
+		notifier.saveDeliveries()
+
+		return
+	}
+
+	if err != nil {
+		notifier.logger.Errorf("giving up to deliver webhook (url: %s, event: %s). %v", delivery.Url, delivery.Event, err)
+	}
+
+	for i, d := range notifier.deliveries {
+		if d == delivery {
+			notifier.deliveries = append(notifier.deliveries[:i], notifier.deliveries[i+1:]...)
+			break
+		}
+	}
+
+	notifier.saveDeliveries()
+}
+
+func (notifier *Notifier) send(delivery *Delivery) error {
+	secret, ok := notifier.getSecret(delivery)
+
+	if !ok {
+		return errWebhookRemoved
+	}
+
+	request, err := http.NewRequest(http.MethodPost, delivery.Url, bytes.NewReader(delivery.Body))
+
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(eventHeader, delivery.Event)
+
+	if len(secret) > 0 {
+		request.Header.Set(signatureHeader, "sha256="+sign(secret, delivery.Body))
+	}
+
+	response, err := notifier.client.Do(request)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// getSecret returns the secret of the webhook of the delivery and whether the
+// webhook still exists. The ids of configured webhooks depend on their order,
+// so the url has to match as well.
+func (notifier *Notifier) getSecret(delivery *Delivery) (string, bool) {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+
+	for _, webhook := range notifier.getWebhooks() {
+		if webhook.Id == delivery.WebhookId && webhook.Url == delivery.Url {
+			return webhook.Secret, true
+		}
+	}
+
+	return "", false
+}
+
+func (notifier *Notifier) saveDeliveries() {
+	if err := writeJsonFile(notifier.deliveriesPath, notifier.deliveries); err != nil {
+		notifier.logger.Errorf("failed to save webhook deliveries. %v", err)
+	}
+}
+
+func newDelivery(webhook *Webhook, event string, message string, data interface{}) (*Delivery, error) {
+	body, err := webhook.render(&Event{
+		Event:   event,
+		Time:    time.Now(),
+		Message: message,
+		Data:    data,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := newId()
+
+	if err != nil {
+		return nil, err
+	}
+
+	delivery := &Delivery{
+		Id:            id,
+		WebhookId:     webhook.Id,
+		Url:           webhook.Url,
+		Event:         event,
+		Body:          body,
+		NextAttemptAt: time.Now(),
+	}
+
+	return delivery, nil
+}
+
+func newId() (string, error) {
+	buf := make([]byte, 8)
+
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+func readJsonFile(path string, v interface{}) error {
+	buf, err := os.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(buf, v)
+}
+
+func writeJsonFile(path string, v interface{}) error {
+	buf, err := json.MarshalIndent(v, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	// the files contain the secrets of the webhooks.
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, buf, 0600); err != nil {
+		return err
+	}
+
+	// files of older versions were readable by everyone.
+	return os.Chmod(path, 0600)
+}
@@ -0,0 +1,256 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testLogger struct{}
+
+func (testLogger) Info(...interface{})           {}
+func (testLogger) Infof(string, ...interface{})  {}
+func (testLogger) Warnf(string, ...interface{})  {}
+func (testLogger) Error(...interface{})          {}
+func (testLogger) Errorf(string, ...interface{}) {}
+func (testLogger) Fatal(...interface{})          {}
+func (testLogger) Fatalf(string, ...interface{}) {}
+
+// testServer records the requests it receives and answers with the queued
+// status codes. It answers with 200 once the queue is empty.
+type testServer struct {
+	*httptest.Server
+
+	mutex    sync.Mutex
+	statuses []int
+	requests []*testRequest
+}
+
+type testRequest struct {
+	Header http.Header
+	Body   []byte
+}
+
+func newTestServer(t *testing.T, statuses ...int) *testServer {
+	server := &testServer{statuses: statuses}
+
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+
+		server.requests = append(server.requests, &testRequest{Header: r.Header, Body: body})
+
+		status := http.StatusOK
+
+		if len(server.statuses) > 0 {
+			status = server.statuses[0]
+			server.statuses = server.statuses[1:]
+		}
+
+		w.WriteHeader(status)
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func newTestNotifier(t *testing.T, webhooks ...*Webhook) *Notifier {
+	directory := t.TempDir()
+
+	return &Notifier{
+		logger:         testLogger{},
+		client:         &http.Client{Timeout: time.Second},
+		webhooksPath:   filepath.Join(directory, webhooksFileName),
+		deliveriesPath: filepath.Join(directory, deliveriesFileName),
+		configured:     webhooks,
+	}
+}
+
+// deliverDue runs one iteration of Run.
+func deliverDue(notifier *Notifier) {
+	for _, delivery := range notifier.getDueDeliveries() {
+		notifier.completeAttempt(delivery, notifier.send(delivery))
+	}
+}
+
+func TestSendSignsBody(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+	}{
+		{name: "with secret", secret: "s3cr3t"},
+		{name: "without secret"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t)
+			notifier := newTestNotifier(t, &Webhook{Id: "config-0", Url: server.URL, Secret: test.secret})
+
+			notifier.Notify("job.completed", "Job 'test' was completed.", nil)
+			deliverDue(notifier)
+
+			if len(server.requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(server.requests))
+			}
+
+			request := server.requests[0]
+
+			if event := request.Header.Get(eventHeader); event != "job.completed" {
+				t.Errorf("got event header %q, want %q", event, "job.completed")
+			}
+
+			want := ""
+
+			if len(test.secret) > 0 {
+				mac := hmac.New(sha256.New, []byte(test.secret))
+				mac.Write(request.Body)
+				want = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+			}
+
+			if signature := request.Header.Get(signatureHeader); signature != want {
+				t.Errorf("got signature %q, want %q", signature, want)
+			}
+		})
+	}
+}
+
+func TestFailedDeliveryIsRetriedWithBackoff(t *testing.T) {
+	server := newTestServer(t, http.StatusInternalServerError, http.StatusBadGateway)
+	notifier := newTestNotifier(t, &Webhook{Id: "config-0", Url: server.URL, Secret: "s3cr3t"})
+
+	notifier.Notify("job.failed", "Job 'test' failed.", nil)
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		before := time.Now()
+		deliverDue(notifier)
+
+		if len(notifier.deliveries) != 1 {
+			t.Fatalf("attempt %d: got %d pending deliveries, want 1", attempt, len(notifier.deliveries))
+		}
+
+		delivery := notifier.deliveries[0]
+		backoff := initialBackoff << (attempt - 1)
+
+		if delivery.Attempts != attempt {
+			t.Errorf("attempt %d: got %d attempts", attempt, delivery.Attempts)
+		}
+
+		if delivery.NextAttemptAt.Before(before.Add(backoff)) || delivery.NextAttemptAt.After(time.Now().Add(backoff)) {
+			t.Errorf("attempt %d: next attempt at %s is not %s after the failure", attempt, delivery.NextAttemptAt, backoff)
+		}
+
+		// the delivery is not due before its backoff elapsed.
+		deliverDue(notifier)
+
+		if len(server.requests) != attempt {
+			t.Fatalf("attempt %d: got %d requests, want %d", attempt, len(server.requests), attempt)
+		}
+
+		delivery.NextAttemptAt = time.Now()
+	}
+
+	deliverDue(notifier)
+
+	if len(server.requests) != 3 {
+		t.Fatalf("got %d requests, want 3", len(server.requests))
+	}
+
+	if len(notifier.deliveries) != 0 {
+		t.Errorf("got %d pending deliveries after success, want 0", len(notifier.deliveries))
+	}
+}
+
+func TestBackoffIsLimited(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		pending  bool
+	}{
+		{name: "capped backoff", attempts: maxAttempts - 2, pending: true},
+		{name: "last attempt", attempts: maxAttempts - 1, pending: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, http.StatusInternalServerError)
+			notifier := newTestNotifier(t, &Webhook{Id: "config-0", Url: server.URL})
+
+			notifier.Notify("job.failed", "Job 'test' failed.", nil)
+			notifier.deliveries[0].Attempts = test.attempts
+
+			deliverDue(notifier)
+
+			if pending := len(notifier.deliveries) > 0; pending != test.pending {
+				t.Fatalf("got pending %v, want %v", pending, test.pending)
+			}
+
+			if test.pending && notifier.deliveries[0].NextAttemptAt.After(time.Now().Add(maxBackoff)) {
+				t.Errorf("next attempt at %s exceeds the maximum backoff", notifier.deliveries[0].NextAttemptAt)
+			}
+		})
+	}
+}
+
+func TestDeliveryOfRemovedWebhookIsDropped(t *testing.T) {
+	server := newTestServer(t)
+	notifier := newTestNotifier(t, &Webhook{Id: "config-0", Url: server.URL})
+
+	notifier.Notify("job.completed", "Job 'test' was completed.", nil)
+	notifier.configured = nil
+
+	deliverDue(notifier)
+
+	if len(server.requests) != 0 {
+		t.Errorf("got %d requests, want 0", len(server.requests))
+	}
+
+	if len(notifier.deliveries) != 0 {
+		t.Errorf("got %d pending deliveries, want 0", len(notifier.deliveries))
+	}
+}
+
+func TestDeliveriesFileOmitsSecret(t *testing.T) {
+	server := newTestServer(t, http.StatusInternalServerError)
+	notifier := newTestNotifier(t, &Webhook{Id: "config-0", Url: server.URL, Secret: "s3cr3t"})
+
+	notifier.Notify("job.failed", "Job 'test' failed.", nil)
+	deliverDue(notifier)
+
+	buf, err := os.ReadFile(notifier.deliveriesPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(buf), "s3cr3t") {
+		t.Errorf("deliveries file contains the secret: %s", buf)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	info, err := os.Stat(notifier.deliveriesPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("got mode %o, want 600", mode)
+	}
+}
@@ -0,0 +1,96 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	TemplateJson    = "json"
+	TemplateDiscord = "discord"
+	TemplateSlack   = "slack"
+	TemplateGotify  = "gotify"
+
+	// EventTest is sent by the test endpoint of a webhook.
+	EventTest = "webhook.test"
+)
+
+// Webhook is an url which receives a POST request for every matching event.
+type Webhook struct {
+	Id       string
+	Url      string
+	Secret   string `json:",omitempty"`
+	Template string `json:",omitempty"`
+
+	// Events restricts the webhook to the given events. An empty list
+	// subscribes to all events.
+	Events []string `json:",omitempty"`
+
+	// Configured is set for webhooks from the configuration file. They can not
+	// be removed through the api.
+	Configured bool `json:"-"`
+}
+
+// Event is the payload of the json template.
+type Event struct {
+	Event   string
+	Time    time.Time
+	Message string
+	Data    interface{} `json:",omitempty"`
+}
+
+// Validate checks whether the webhook can be used.
+func (webhook *Webhook) Validate() error {
+	if len(webhook.Url) == 0 {
+		return fmt.Errorf("property 'Url' has no value")
+	}
+
+	switch webhook.Template {
+	case "", TemplateJson, TemplateDiscord, TemplateSlack, TemplateGotify:
+		return nil
+	default:
+		return fmt.Errorf("unknown template '%s'", webhook.Template)
+	}
+}
+
+func (webhook *Webhook) subscribes(event string) bool {
+	if len(webhook.Events) == 0 || event == EventTest {
+		return true
+	}
+
+	for _, e := range webhook.Events {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// render turns the event into the request body of the webhook template.
+func (webhook *Webhook) render(event *Event) ([]byte, error) {
+	text := fmt.Sprintf("[gogdl-ng] %s", event.Message)
+
+	switch webhook.Template {
+	case TemplateDiscord:
+		return json.Marshal(map[string]interface{}{"content": text})
+	case TemplateSlack:
+		return json.Marshal(map[string]interface{}{"text": text})
+	case TemplateGotify:
+		return json.Marshal(map[string]interface{}{"title": "gogdl-ng: " + event.Event, "message": event.Message, "priority": 5})
+	default:
+		return json.Marshal(event)
+	}
+}
+
+// sign returns the hex encoded HMAC-SHA256 of the body.
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}